@@ -14,15 +14,46 @@ GOARCH=amd64p32 GOOS=nacl go install std
 GOARCH=386 GOOS=nacl go install std
 go install -race -a std
 go install -a std
-go get -u code.google.com/p/gosmith/gosmith
 go get -u code.google.com/p/go.tools/cmd/ssadump
 go run driver.go
+
+To replay a reported seed (or an inclusive seed range) with the given checkers:
+go run driver.go -seed=123 -checkers=386,exec -v
+In this mode the driver prints every command with its environment (-v),
+keeps failing tests in workdir/bug and exits with status 1 if any test
+has failed, 2 if the driver itself has failed and 0 otherwise.
+
+Known bugs are suppressed according to known.json (see KnownBug),
+number of hits of each suppression is written to workdir/known.hits.
+
+Programs are built in module mode with empty GOFLAGS and GOCACHE in workdir/cache,
+so that user settings don't affect the results. The -gopath flag switches to
+the legacy GOPATH layout and mode.
+
+Failures are grouped into buckets by signature, only a few seeds
+per bucket are saved in workdir/bug. Buckets are listed in workdir/buckets.
+Counts of generated constructs summed over manifest.json of all programs
+are written to workdir/features.
+Programs are generated in-process with the smith package,
+programs that do not type-check are saved as "gosmith" failures,
+they are generator bugs rather than compiler bugs.
+
+The types and types.gofmt checkers compare verdicts of gc and go/types
+on the program and on its gofmt-ed variant, disagreements point to bugs
+in one of the front ends or in the spec.
+
+The determinism checker generates every program twice and compares the trees,
+to check that a range of seeds is reproducible:
+go run driver.go -checkers=determinism -seed=1-300
 */
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"go/scanner"
+	"go/token"
 	"io/ioutil"
 	"log"
 	"math/rand"
@@ -31,106 +62,156 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/dvyukov/gosmith/smith"
 )
 
 var (
 	parallelism = flag.Int("p", runtime.NumCPU(), "number of parallel tests")
-	checkers    = flag.String("checkers", "all", "comma-delimited list of checkers (amd64,386,arm,nacl64,nacl32,race,gccgo,ssa,gofmt,cover,exec)")
+	checkers    = flag.String("checkers", "all", "comma-delimited list of checkers")
 	workDir     = flag.String("workdir", "./work", "working directory for temp files")
 	timeout     = flag.Int64("timeout", 10, "task timeout in seconds")
+	safe        = flag.Bool("safe", false, "generate programs without undefined behavior, runtime panics and hangs are bugs")
+	seedFlag    = flag.String("seed", "", "replay the seed or the seed range (e.g. 10-20) and exit")
+	verbose     = flag.Bool("v", false, "print executed commands, their environment and output")
+	knownFile   = flag.String("known", "known.json", "file with known bugs")
+	bucketSize  = flag.Int("bucket", 3, "max number of saved bugs with the same signature")
+	gopath      = flag.Bool("gopath", false, "generate and build programs in the legacy GOPATH layout")
+	profile     = flag.String("profile", "default", "gosmith generation profile (built-in name or JSON file)")
+	swarm       = flag.Bool("swarm", false, "generate every program with a random subset of features of the profile")
 
-	statTotal   uint64
-	statBuild   uint64
-	statSsadump uint64
-	statGofmt   uint64
-	statExec    uint64
-	statKnown   uint64
-
-	knownBuildBugs   = make(map[string][]*regexp.Regexp)
-	knownSsadumpBugs = []*regexp.Regexp{}
-	knownCoverBugs   = []*regexp.Regexp{
-		regexp.MustCompile("syntax error near GoCover_"), // http://golang.org/issue/10163
-	}
-	knownExecBugs = []*regexp.Regexp{
-		regexp.MustCompile("panic: "),
-		regexp.MustCompile("go of nil func value"),
-		regexp.MustCompile("fatal error: all goroutines are asleep - deadlock!"),
-		regexp.MustCompile("SIGABRT: abort"), // gc timeout
-		regexp.MustCompile("Aborted"),        // gccgo timeout
-		regexp.MustCompile("DATA RACE"),      // gosmith can generate a data race
-		regexp.MustCompile("limit on 8192 simultaneously alive goroutines is exceeded"),
-
-		// nacl:
-		regexp.MustCompile("Signal 6 from trusted code"),
-		regexp.MustCompile("Signal 11 from trusted code"),
-		regexp.MustCompile("Signal 6 from untrusted code"),
-		regexp.MustCompile("Signal 11 from untrusted code"),
-		regexp.MustCompile("fatal error: out of memory"),
-		regexp.MustCompile("fatal error: runtime: address space conflict"), // nacl says this when we exhaust all memory
-
-		// bad:
-		regexp.MustCompile("unexpected return pc for runtime.goexit called from 0x0"), // http://golang.org/issue/8766
-		regexp.MustCompile("__go_map_delete"),                                         // gccgo
-		//regexp.MustCompile("fatal error: runtime_lock: lock count"), // gccgo
-		//regexp.MustCompile("fatal error: stopm holding locks"),      // gccgo
-		// gllgo:
-		//regexp.MustCompile("unexpected fault address 0x0"),
-		// ssa interp:
-		regexp.MustCompile("ssa/interp\\.\\(\\*frame\\)\\.runDefers"),
-	}
+	statTotal     uint64
+	statBuild     uint64
+	statSsadump   uint64
+	statGofmt     uint64
+	statExec      uint64
+	statChecksum  uint64
+	statKnown     uint64
+	statGenerator uint64
+	statTypes     uint64
+
+	bucketsMu sync.Mutex
+	buckets   = make(map[string]*Bucket)
+
+	// featuresMu protects sum of features of all generated programs.
+	featuresMu      sync.Mutex
+	features        smith.Features
+	featurePrograms int
+
+	knownBugs  []*KnownBug
+	genProfile *smith.Profile
+)
+
+// allCheckers is the registry of checkers, enabled checkers run in this order.
+var allCheckers = []Checker{
+	&Toolchain{name: "amd64", compiler: "gc", goarch: "amd64"},
+	&Toolchain{name: "386", compiler: "gc", goarch: "386"},
+	&Toolchain{name: "arm", compiler: "gc", goarch: "arm", noexec: true},
+	&Toolchain{name: "nacl64", compiler: "gc", goos: "nacl", goarch: "amd64p32"},
+	&Toolchain{name: "nacl32", compiler: "gc", goos: "nacl", goarch: "386"},
+	&Toolchain{name: "race", compiler: "gc", goarch: "amd64", race: true},
+	&Toolchain{name: "noopt", compiler: "gc", goarch: "amd64", noopt: true},
+	&Toolchain{name: "gccgo", compiler: "gccgo", goarch: "amd64"},
+	SsaChecker{},
+	GofmtChecker{},
+	TypesChecker{},
+	TypesChecker{gofmt: true},
+	DeterminismChecker{},
+}
+
+// Checker tests the generated program in some way.
+// All steps return true if they have found a bug.
+type Checker interface {
+	Name() string
+	// Build compiles or otherwise checks the program.
+	Build(t *Test) bool
+	// Exec runs the program built by Build, it is enabled by the "exec" checker.
+	Exec(t *Test) bool
+	// Cover builds the program with coverage instrumentation, it is enabled by the "cover" checker.
+	Cover(t *Test) bool
+}
+
+var (
+	selected        map[string]bool
+	enabledCheckers []Checker
 )
 
 func init() {
-	knownBuildBugs["all"] = []*regexp.Regexp{
-		regexp.MustCompile("constant .* overflows"), // problem is gosmith
+	names := []string{"all", "exec", "cover"}
+	for _, c := range allCheckers {
+		names = append(names, c.Name())
 	}
+	flag.Lookup("checkers").Usage = fmt.Sprintf("comma-delimited list of checkers (%v)", strings.Join(names, ","))
+}
 
-	knownBuildBugs["gc"] = []*regexp.Regexp{}
-	knownBuildBugs["gc..amd64"] = []*regexp.Regexp{}
-	knownBuildBugs["gc.nacl.amd64p32"] = []*regexp.Regexp{
-		regexp.MustCompile("internal compiler error: out of fixed registers"), // http://golang.org/issue/8012, https://github.com/golang/go/issues/10088
-	}
-	knownBuildBugs["gc..386"] = []*regexp.Regexp{
-		regexp.MustCompile("internal compiler error: out of fixed registers"), // https://github.com/golang/go/issues/13277
-	}
-	knownBuildBugs["gc..arm"] = []*regexp.Regexp{
-		regexp.MustCompile("internal compiler error: out of fixed registers"), // http://golang.org/issue/10088
+// selectCheckers enables checkers from the comma-delimited list.
+func selectCheckers(list string) error {
+	selected = make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		selected[name] = true
+	}
+	known := map[string]bool{"all": true, "exec": true, "cover": true}
+	for _, c := range allCheckers {
+		known[c.Name()] = true
+		if enabled(c.Name()) {
+			enabledCheckers = append(enabledCheckers, c)
+		}
 	}
-	knownBuildBugs["gc..amd64.race"] = []*regexp.Regexp{
-		regexp.MustCompile("internal compiler error: out of fixed registers"), // http://golang.org/issue/8012
-		regexp.MustCompile("internal compiler error: treecopy Name"),          // http://golang.org/issue/12225
+	for name := range selected {
+		if !known[name] {
+			return fmt.Errorf("unknown checker %q", name)
+		}
 	}
-	knownBuildBugs["gccgo"] = []*regexp.Regexp{
-		regexp.MustCompile("internal compiler error: in fold_binary_loc, at fold-const.c:10024"),
-		regexp.MustCompile("internal compiler error: in write_specific_type_functions, at go/gofrontend/types.cc:1819"),
-		regexp.MustCompile("internal compiler error: in fold_convert_loc, at fold-const.c:2072"),
-		regexp.MustCompile("internal compiler error: in do_determine_types, at go/gofrontend/statements.cc:400"),
-		regexp.MustCompile("internal compiler error: verify_gimple failed"),
-		regexp.MustCompile("internal compiler error: in descriptor, at go/gofrontend/gogo.cc:4572"),         // https://gcc.gnu.org/bugzilla/show_bug.cgi?id=61307
-		regexp.MustCompile("internal compiler error: in check_bounds, at go/gofrontend/expressions.cc:480"), // https://gcc.gnu.org/bugzilla/show_bug.cgi?id=61308
-		regexp.MustCompile("error: too many arguments"),
-		regexp.MustCompile("error: expected '<-' or '='"),
-		regexp.MustCompile("error: slice end must be integer"),
-		regexp.MustCompile("error: argument 2 has incompatible type"),
-		regexp.MustCompile("error: incompatible types in assignment (multiple-value function call in single-value context)"), // https://gcc.gnu.org/bugzilla/show_bug.cgi?id=61316
-		regexp.MustCompile("__normal_iterator"),
-		regexp.MustCompile("Unsafe_type_conversion_expression::do_get_backend"),
+	return nil
+}
 
-		// gllgo
-		regexp.MustCompile("_Cfunc_LLVMTargetMachineEmitToMemoryBuffer"), // https://github.com/go-llvm/llgo/issues/174
-		regexp.MustCompile("panic: unimplemented conversion"),            // https://github.com/go-llvm/llgo/issues/176
-	}
+func enabled(what string) bool {
+	return selected["all"] || selected[what]
 }
 
 func main() {
 	flag.Parse()
-	log.Printf("testing with %v workers", *parallelism)
+	if err := selectCheckers(*checkers); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if abs, err := filepath.Abs(*workDir); err == nil {
+		*workDir = abs
+	}
 	os.MkdirAll(filepath.Join(*workDir, "tmp"), os.ModePerm)
 	os.MkdirAll(filepath.Join(*workDir, "bug"), os.ModePerm)
+	if err := loadKnownBugs(*knownFile); err != nil {
+		log.Printf("failed to load known bugs: %v", err)
+		os.Exit(2)
+	}
+	var err error
+	if genProfile, err = smith.LoadProfile(*profile); err != nil {
+		log.Printf("failed to load profile: %v", err)
+		os.Exit(2)
+	}
+	loadBuckets()
+	for _, c := range enabledCheckers {
+		if tc, ok := c.(*Toolchain); ok {
+			tc.warmCache()
+		}
+	}
+	if *seedFlag != "" {
+		status := replay(*seedFlag)
+		writeKnownHits()
+		writeBuckets()
+		writeFeatures()
+		os.Exit(status)
+	}
+	log.Printf("testing with %v workers", *parallelism)
 	rand.Seed(time.Now().UnixNano())
 	seed := rand.Int63()
 	for p := 0; p < *parallelism; p++ {
@@ -150,323 +231,691 @@ func main() {
 		ssadump := atomic.LoadUint64(&statSsadump)
 		gofmt := atomic.LoadUint64(&statGofmt)
 		exec := atomic.LoadUint64(&statExec)
-		log.Printf("%v tests, %v known, %v build, %v ssadump, %v gofmt, %v exec",
-			total, known, build, ssadump, gofmt, exec)
+		checksum := atomic.LoadUint64(&statChecksum)
+		generator := atomic.LoadUint64(&statGenerator)
+		types := atomic.LoadUint64(&statTypes)
+		log.Printf("%v tests, %v known, %v generator, %v build, %v ssadump, %v gofmt, %v types, %v exec, %v checksum%v",
+			total, known, generator, build, ssadump, gofmt, types, exec, checksum, bucketSummary(5))
+		writeKnownHits()
+		writeBuckets()
+		writeFeatures()
 		time.Sleep(3 * time.Second)
 	}
 }
 
+// replay runs tests for the seed range and returns the exit status.
+func replay(seeds string) int {
+	from, to, err := parseSeedRange(seeds)
+	if err != nil {
+		log.Printf("bad seed %q: %v", seeds, err)
+		return 2
+	}
+	status := 0
+	for s := from; s <= to; s++ {
+		t := &Test{seed: fmt.Sprintf("%v", s)}
+		switch {
+		case !t.Do():
+			log.Printf("seed %v: driver failed", t.seed)
+			status = 2
+		case t.keep:
+			log.Printf("seed %v: FAILED: %v, see %v", t.seed, t.sig, filepath.Join(*workDir, "bug", t.seed))
+			if status == 0 {
+				status = 1
+			}
+		default:
+			log.Printf("seed %v: ok", t.seed)
+		}
+	}
+	return status
+}
+
+// parseSeedRange parses a seed (N) or an inclusive seed range (N-M).
+func parseSeedRange(seeds string) (from, to int64, err error) {
+	fromStr, toStr := seeds, seeds
+	if i := strings.Index(seeds, "-"); i > 0 {
+		fromStr, toStr = seeds[:i], seeds[i+1:]
+	}
+	if from, err = strconv.ParseInt(fromStr, 10, 64); err != nil {
+		return
+	}
+	if to, err = strconv.ParseInt(toStr, 10, 64); err != nil {
+		return
+	}
+	if from > to {
+		err = fmt.Errorf("empty range")
+	}
+	return
+}
+
 type Test struct {
-	seed   string
-	path   string
-	gopath string
-	keep   bool
+	seed      string
+	path      string // absolute
+	keep      bool
+	sig       string                    // signature of the found bug
+	checksums map[string]smith.Checksum // program checksum printed by each exec variant
 }
 
-func (t *Test) Do() {
+// Do runs all enabled checkers and sets t.keep if any of them has found a bug.
+// It returns false if the test could not be run.
+func (t *Test) Do() bool {
 	t.path = filepath.Join(*workDir, "tmp", t.seed)
 	os.Mkdir(t.path, os.ModePerm)
 	defer func() {
-		if t.keep {
-			os.Rename(t.path, filepath.Join(*workDir, "bug", t.seed))
+		// Replayed seeds are always saved.
+		if t.keep && (addFinding(t.sig, t.seed) || *seedFlag != "") {
+			if err := ioutil.WriteFile(filepath.Join(t.path, "signature"), []byte(t.sig+"\n"), 0644); err != nil {
+				log.Printf("failed to create output file: %v", err)
+			}
+			if err := os.Rename(t.path, filepath.Join(*workDir, "bug", t.seed)); err != nil {
+				log.Printf("failed to save test: %v", err)
+			}
 		} else {
 			os.RemoveAll(t.path)
 		}
 	}()
 	if !t.generateSource() {
-		return
+		// Invalid programs are generator bugs and are saved,
+		// other failures are driver failures.
+		return t.keep
+	}
+	t.addFeatures()
+	for _, c := range enabledCheckers {
+		if c.Build(t) || enabled("exec") && c.Exec(t) {
+			t.keep = true
+			return true
+		}
 	}
-	if enabled("amd64") && t.Build("gc", "", "amd64", false) {
+	if *safe && enabled("exec") && t.CompareChecksums() {
 		t.keep = true
-		return
+		return true
 	}
-	if enabled("amd64") && enabled("exec") && t.Exec("gc", "", "amd64", false) {
-		t.keep = true
-		return
+	if enabled("cover") {
+		for _, c := range enabledCheckers {
+			if c.Cover(t) {
+				t.keep = true
+				return true
+			}
+		}
 	}
-	if enabled("386") && t.Build("gc", "", "386", false) {
-		t.keep = true
-		return
+	return true
+}
+
+// generateSource generates the program for the test seed into the test dir.
+func (t *Test) generateSource() bool {
+	prog, err := t.generate()
+	if err != nil {
+		log.Printf("failed to generate program for seed %v: %v", t.seed, err)
+		return false
 	}
-	if enabled("386") && enabled("exec") && t.Exec("gc", "", "386", false) {
-		t.keep = true
-		return
+	checkErr := prog.Check()
+	// The invalid program is still written, so that it can be inspected.
+	if err := prog.Write(t.path); err != nil {
+		log.Printf("failed to write program for seed %v: %v", t.seed, err)
+		return false
 	}
-	if enabled("arm") && t.Build("gc", "", "arm", false) {
+	if checkErr != nil {
+		atomic.AddUint64(&statGenerator, 1)
+		t.saveFailure("gosmith", []byte(fmt.Sprintf("generated program is invalid: %v\n", checkErr)))
 		t.keep = true
-		return
+		return false
 	}
-	if enabled("nacl64") && t.Build("gc", "nacl", "amd64p32", false) {
-		t.keep = true
-		return
+	return true
+}
+
+// generate generates the program for the test seed in-process.
+// Generator panics are returned as errors, so that they don't kill the driver.
+func (t *Test) generate() (prog smith.Program, err error) {
+	seed, err := strconv.ParseInt(t.seed, 10, 64)
+	if err != nil {
+		return nil, err
 	}
-	if enabled("nacl64") && enabled("exec") && t.Exec("gc", "nacl", "amd64p32", false) {
-		t.keep = true
-		return
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("generator panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	opts := smith.Options{
+		Safe:    *safe,
+		GOPATH:  *gopath,
+		Profile: genProfile,
+		Swarm:   *swarm,
 	}
-	if enabled("nacl32") && t.Build("gc", "nacl", "386", false) {
-		t.keep = true
-		return
+	return smith.NewGenerator(seed, opts).Generate(), nil
+}
+
+// command returns the command that runs in the program dir with environment
+// for the go tool in module or GOPATH mode. Variables in env override it.
+func (t *Test) command(env []string, name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = t.path
+	// Later values take precedence.
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOCACHE="+filepath.Join(*workDir, "cache"))
+	if *gopath {
+		cmd.Env = append(cmd.Env, "GO111MODULE=off", "GOPATH="+t.path+":"+os.Getenv("GOPATH"))
+	} else {
+		cmd.Env = append(cmd.Env, "GO111MODULE=on", "GOWORK=off", "GOTOOLCHAIN=local")
 	}
-	if enabled("nacl32") && enabled("exec") && t.Exec("gc", "nacl", "386", false) {
-		t.keep = true
-		return
+	cmd.Env = append(cmd.Env, env...)
+	return cmd
+}
+
+// pkg returns the go tool argument for the generated package name.
+func pkg(name string) string {
+	if *gopath {
+		return name
 	}
-	if enabled("race") && t.Build("gc", "", "amd64", true) {
-		t.keep = true
-		return
+	return "./" + name
+}
+
+// srcDir returns the directory with generated packages.
+func (t *Test) srcDir() string {
+	if *gopath {
+		return filepath.Join(t.path, "src")
 	}
-	if enabled("race") && enabled("exec") && t.Exec("gc", "", "amd64", true) {
-		t.keep = true
-		return
+	return t.path
+}
+
+// Toolchain builds and runs the program with a compiler for an architecture.
+type Toolchain struct {
+	name     string
+	compiler string
+	goos     string
+	goarch   string
+	race     bool
+	noopt    bool
+	noexec   bool // binaries can't be run on the host
+}
+
+func (c *Toolchain) Name() string {
+	return c.name
+}
+
+// variant returns name of the build variant.
+func (c *Toolchain) variant() string {
+	typ := c.compiler + "." + c.goos + "." + c.goarch
+	if c.race {
+		typ += ".race"
 	}
-	if enabled("gccgo") && t.Build("gccgo", "", "amd64", false) {
-		t.keep = true
-		return
+	if c.noopt {
+		typ += ".noopt"
 	}
-	if enabled("gccgo") && enabled("exec") && t.Exec("gccgo", "", "amd64", false) {
-		t.keep = true
-		return
+	return typ
+}
+
+// command returns the go command with environment for the toolchain.
+func (c *Toolchain) command(t *Test, args ...string) *exec.Cmd {
+	env := []string{"GOARCH=" + c.goarch}
+	if c.goos != "" {
+		env = append(env, "GOOS="+c.goos)
 	}
-	if enabled("ssa") && t.Ssadump() {
-		t.keep = true
-		return
+	return t.command(env, "go", args...)
+}
+
+// flags returns build flags for the toolchain.
+func (c *Toolchain) flags() []string {
+	args := []string{"-compiler", c.compiler}
+	if c.race {
+		args = append(args, "-race")
 	}
-	if enabled("ssa") && enabled("exec") && t.SsadumpExec() {
-		t.keep = true
-		return
+	if c.noopt {
+		args = append(args, "-gcflags=-N -l")
 	}
-	// TODO: add other variants (386, arm, nacl, race, etc)
-	if enabled("cover") && t.Cover("gc", "", "amd64", false) {
-		t.keep = true
-		return
+	return args
+}
+
+// warmCache builds the standard library into the isolated build cache,
+// otherwise first builds don't fit into the timeout.
+func (c *Toolchain) warmCache() {
+	args := []string{"build", "-compiler", c.compiler}
+	if c.race {
+		args = append(args, "-race")
 	}
-	if enabled("gofmt") && t.Gofmt() {
-		t.keep = true
-		return
+	args = append(args, "std")
+	log.Printf("building std for %v", c.variant())
+	if out, err := runCommand(c.command(&Test{path: *workDir}, args...)); err != nil {
+		log.Printf("failed to build std for %v: %v\n%s", c.variant(), err, out)
 	}
 }
 
-func enabled(what string) bool {
-	return *checkers == "all" || strings.Contains(*checkers, what)
+func (c *Toolchain) Build(t *Test) bool {
+	typ := c.variant()
+	outbin := filepath.Join(t.path, "bin"+typ)
+	args := []string{"build", "-o", outbin}
+	args = append(args, c.flags()...)
+	args = append(args, pkg("main"))
+	out, err := runWithTimeout(c.command(t, args...))
+	if err == nil {
+		return false
+	}
+	if knownBug(out, typ) {
+		return false
+	}
+	t.saveFailure(typ, out)
+	log.Printf("%v build failed, seed %v\n", typ, t.seed)
+	atomic.AddUint64(&statBuild, 1)
+	return true
 }
 
-func (t *Test) generateSource() bool {
-	args := []string{"-seed", t.seed, "-dir", t.path}
-	out, err := exec.Command("gosmith", args...).CombinedOutput()
-	if err != nil {
-		log.Printf("failed to execute gosmith for seed %v: %v\n%v\n", t.seed, err, string(out))
+func (c *Toolchain) Cover(t *Test) bool {
+	typ := "cover." + c.variant()
+	outbin := filepath.Join(t.path, "coverbin"+typ)
+	args := []string{"test", "-c", "-cover", "-o", outbin}
+	args = append(args, c.flags()...)
+	args = append(args, pkg("a"))
+	out, err := runWithTimeout(c.command(t, args...))
+	if err == nil {
 		return false
 	}
-	pwd, err := os.Getwd()
-	if err != nil {
-		log.Printf("failed to pwd: %v", err)
+	if knownBug(out, typ, c.variant()) {
 		return false
 	}
-	t.gopath = filepath.Join(pwd, t.path)
+	t.saveFailure(typ, out)
+	log.Printf("%v failed, seed %v\n", typ, t.seed)
+	atomic.AddUint64(&statBuild, 1)
 	return true
 }
 
-func (t *Test) Build(compiler, goos, goarch string, race bool) bool {
-	typ := compiler + "." + goos + "." + goarch
-	if race {
-		typ += ".race"
+func (c *Toolchain) Exec(t *Test) bool {
+	if c.noexec {
+		return false
 	}
+	typ := c.variant()
 	outbin := filepath.Join(t.path, "bin"+typ)
-	args := []string{"build", "-o", outbin, "-compiler", compiler}
-	if race {
-		args = append(args, "-race")
+	if _, err := os.Stat(outbin); err != nil {
+		return false
 	}
-	args = append(args, "main")
-	cmd := exec.Command("go", args...)
-	cmd.Env = []string{"GOARCH=" + goarch, "GOPATH=" + t.gopath + ":" + os.Getenv("GOPATH")}
-	if goos != "" {
-		cmd.Env = append(cmd.Env, "GOOS="+goos)
+	cmd := exec.Command(outbin)
+	if c.goos == "nacl" {
+		cmd = exec.Command("bash", "go_nacl_"+c.goarch+"_exec", outbin)
 	}
-	cmd.Env = append(cmd.Env, os.Environ()...)
+	cmd.Env = append(os.Environ(), "GOMAXPROCS=2", "GOGC=0")
 	out, err := runWithTimeout(cmd)
 	if err == nil {
+		t.recordChecksum(typ, out)
 		return false
 	}
-	for _, known := range knownBuildBugs[typ] {
-		if known.Match(out) {
-			atomic.AddUint64(&statKnown, 1)
-			return false
+	if knownBug(out, "exec."+typ) {
+		return false
+	}
+	t.saveFailure("exec."+typ, out)
+	log.Printf("%v exec failed, seed %v\n", typ, t.seed)
+	atomic.AddUint64(&statExec, 1)
+	return true
+}
+
+// KnownBug is a suppression of a known failure.
+type KnownBug struct {
+	Regexp string // matched against the failure output
+	// Scope is a list of failure names the suppression applies to.
+	// Failure names are names of the output files that the driver saves
+	// in the bug dir: build variants (gc..386, gccgo..amd64, gc..amd64.race),
+	// cover.<variant>, exec.<variant>, ssadump and ssadump.run.
+	// A scope key also matches all names that start with the key followed by a dot,
+	// e.g. gccgo matches gccgo..amd64 and exec matches all execution failures.
+	Scope []string
+	Issue string // bug tracker URL
+	Fixed string // version that contains the fix, if any
+	// Unsafe suppressions are expected failures of programs with undefined behavior,
+	// they don't apply in the safe mode where such failures are bugs.
+	Unsafe bool
+
+	re   *regexp.Regexp
+	hits uint64
+}
+
+func loadKnownBugs(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &knownBugs); err != nil {
+		return fmt.Errorf("failed to parse %v: %v", file, err)
+	}
+	for _, kb := range knownBugs {
+		if kb.re, err = regexp.Compile(kb.Regexp); err != nil {
+			return fmt.Errorf("bad regexp in %v: %v", file, err)
+		}
+		if len(kb.Scope) == 0 {
+			return fmt.Errorf("no scope for %q in %v", kb.Regexp, file)
 		}
 	}
-	for _, known := range knownBuildBugs[compiler] {
-		if known.Match(out) {
+	return nil
+}
+
+// knownBug says whether the failure output out is a known bug
+// for any of the failure names.
+func knownBug(out []byte, names ...string) bool {
+	for _, kb := range knownBugs {
+		if (!kb.Unsafe || !*safe) && kb.inScope(names) && kb.re.Match(out) {
+			atomic.AddUint64(&kb.hits, 1)
 			atomic.AddUint64(&statKnown, 1)
-			return false
+			return true
 		}
 	}
-	for _, known := range knownBuildBugs["all"] {
-		if known.Match(out) {
-			atomic.AddUint64(&statKnown, 1)
-			return false
+	return false
+}
+
+func (kb *KnownBug) inScope(names []string) bool {
+	for _, key := range kb.Scope {
+		for _, name := range names {
+			if name == key || strings.HasPrefix(name, key+".") {
+				return true
+			}
 		}
 	}
-	outf, err := os.Create(filepath.Join(t.path, typ))
+	return false
+}
+
+// writeKnownHits writes number of hits of each known bug to workdir/known.hits.
+// Suppressions without hits are candidates for removal.
+func writeKnownHits() {
+	f, err := os.Create(filepath.Join(*workDir, "known.hits"))
 	if err != nil {
 		log.Printf("failed to create output file: %v", err)
-	} else {
-		outf.Write(out)
-		outf.Close()
+		return
 	}
-	log.Printf("%v build failed, seed %v\n", typ, t.seed)
-	atomic.AddUint64(&statBuild, 1)
+	defer f.Close()
+	for _, kb := range knownBugs {
+		fmt.Fprintf(f, "%v\t%q\t%v", atomic.LoadUint64(&kb.hits), kb.Regexp, strings.Join(kb.Scope, ","))
+		if kb.Issue != "" {
+			fmt.Fprintf(f, "\t%v", kb.Issue)
+		}
+		if kb.Fixed != "" {
+			fmt.Fprintf(f, "\tfixed in %v", kb.Fixed)
+		}
+		if kb.Unsafe {
+			fmt.Fprintf(f, "\tunsafe")
+		}
+		fmt.Fprintf(f, "\n")
+	}
+}
+
+// SsaChecker builds and interprets the program with ssadump.
+type SsaChecker struct{}
+
+func (SsaChecker) Name() string {
+	return "ssa"
+}
+
+func (SsaChecker) Cover(t *Test) bool {
+	return false
+}
+
+func (SsaChecker) Build(t *Test) bool {
+	out, err := runCommand(t.command(nil, "ssadump", "-build=CDPF", pkg("main")))
+	if err == nil {
+		return false
+	}
+	if knownBug(out, "ssadump") {
+		return false
+	}
+	t.saveFailure("ssadump", out)
+	log.Printf("ssadump failed, seed %v\n", t.seed)
+	atomic.AddUint64(&statSsadump, 1)
 	return true
 }
 
-func (t *Test) Cover(compiler, goos, goarch string, race bool) bool {
-	typ := "cover." + compiler + "." + goos + "." + goarch
-	if race {
-		typ += ".race"
+func (SsaChecker) Exec(t *Test) bool {
+	cmd := t.command([]string{"GOMAXPROCS=2", "GOGC=10"}, "ssadump", "-run", pkg("main"))
+	out, err := runCommand(cmd)
+	if err == nil {
+		t.recordChecksum("ssa", out)
+		return false
 	}
-	outbin := filepath.Join(t.path, "coverbin"+typ)
-	args := []string{"test", "-c", "-cover", "-o", outbin, "-compiler", compiler}
-	if race {
-		args = append(args, "-race")
+	if knownBug(out, "ssadump.run") {
+		return false
 	}
-	args = append(args, "a")
-	cmd := exec.Command("go", args...)
-	cmd.Env = []string{"GOARCH=" + goarch, "GOPATH=" + t.gopath + ":" + os.Getenv("GOPATH")}
-	if goos != "" {
-		cmd.Env = append(cmd.Env, "GOOS="+goos)
+	t.saveFailure("ssadump.run", out)
+	log.Printf("ssadump.run failed, seed %v\n", t.seed)
+	atomic.AddUint64(&statSsadump, 1)
+	return true
+}
+
+// GofmtChecker checks that gofmt preserves the program and is idempotent.
+type GofmtChecker struct{}
+
+func (GofmtChecker) Name() string {
+	return "gofmt"
+}
+
+func (GofmtChecker) Build(t *Test) bool {
+	return t.Gofmt()
+}
+
+func (GofmtChecker) Exec(t *Test) bool {
+	return false
+}
+
+func (GofmtChecker) Cover(t *Test) bool {
+	return false
+}
+
+// TypesChecker compares verdicts of go/types and of the gc front end on the program
+// (or on its gofmt-ed variant). Programs accepted by one and rejected by the other
+// and programs rejected by both with errors on different lines are bugs
+// in one of them or in the spec.
+type TypesChecker struct {
+	gofmt bool
+}
+
+// Test subdirs with variants of the program, they are not part of the program.
+const (
+	gofmtDir = "gofmt" // gofmt-ed program
+	regenDir = "regen" // program generated again from the same seed
+)
+
+func (c TypesChecker) Name() string {
+	if c.gofmt {
+		return "types.gofmt"
 	}
-	cmd.Env = append(cmd.Env, os.Environ()...)
-	out, err := runWithTimeout(cmd)
-	if err == nil {
+	return "types"
+}
+
+func (c TypesChecker) Build(t *Test) bool {
+	name := c.Name()
+	prog, err := readProgram(t.path)
+	if err != nil {
+		log.Printf("failed to read program: %v", err)
 		return false
 	}
-	for _, known := range knownBuildBugs[compiler+"."+goos+"."+goarch] {
-		if known.Match(out) {
-			atomic.AddUint64(&statKnown, 1)
+	vt := t
+	if c.gofmt {
+		vt = &Test{seed: t.seed, path: filepath.Join(t.path, gofmtDir)}
+		if err := prog.Write(vt.path); err != nil {
+			log.Printf("failed to write program: %v", err)
 			return false
 		}
-	}
-	for _, known := range knownBuildBugs[compiler] {
-		if known.Match(out) {
-			atomic.AddUint64(&statKnown, 1)
+		if _, err := runCommand(exec.Command("gofmt", "-w", vt.path)); err != nil {
+			// Reported by the gofmt checker.
 			return false
 		}
-	}
-	for _, known := range knownBuildBugs["all"] {
-		if known.Match(out) {
-			atomic.AddUint64(&statKnown, 1)
+		if prog, err = readProgram(vt.path); err != nil {
+			log.Printf("failed to read program: %v", err)
 			return false
 		}
 	}
-	for _, known := range knownCoverBugs {
-		if known.Match(out) {
-			atomic.AddUint64(&statKnown, 1)
-			return false
-		}
+	var typesOut bytes.Buffer
+	for _, err := range prog.Errors() {
+		fmt.Fprintf(&typesOut, "%v\n", err)
 	}
-	outf, err := os.Create(filepath.Join(t.path, typ))
-	if err != nil {
-		log.Printf("failed to create output file: %v", err)
-	} else {
-		outf.Write(out)
-		outf.Close()
+	gcOut, err := runWithTimeout(vt.command(nil, "go", "build", "-o", os.DevNull, pkg("main")))
+	if err != nil && knownBug(gcOut, name) {
+		return false
 	}
-	log.Printf("%v failed, seed %v\n", typ, t.seed)
-	atomic.AddUint64(&statBuild, 1)
+	verdict, out := smith.TypesVerdict(gcOut, err == nil, typesOut.Bytes())
+	if verdict == "" {
+		return false
+	}
+	t.saveFailure(name, []byte(fmt.Sprintf("%v\n\ngc:\n%s\ngo/types:\n%s", verdict, gcOut, typesOut.Bytes())))
+	t.sig = smith.Signature(name+": "+verdict, out)
+	log.Printf("%v: %v, seed %v\n", name, verdict, t.seed)
+	atomic.AddUint64(&statTypes, 1)
 	return true
 }
 
-func (t *Test) Exec(compiler, goos, goarch string, race bool) bool {
-	typ := compiler + "." + goos + "." + goarch
-	if race {
-		typ += ".race"
+func (TypesChecker) Exec(t *Test) bool {
+	return false
+}
+
+func (TypesChecker) Cover(t *Test) bool {
+	return false
+}
+
+// readProgram reads Go files, go.mod, profile.json and manifest.json of the program in dir
+// (without its variants).
+func readProgram(dir string) (smith.Program, error) {
+	prog := make(smith.Program)
+	err := filepath.Walk(dir, func(fname string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if fname != dir && (info.Name() == gofmtDir || info.Name() == regenDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(fname, ".go") && info.Name() != "go.mod" && info.Name() != "profile.json" && info.Name() != "manifest.json" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, fname)
+		if err != nil {
+			return err
+		}
+		prog[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	return prog, err
+}
+
+// DeterminismChecker generates the program from the same seed again
+// and checks that the output is byte-identical, otherwise seeds can't be replayed
+// and reduced programs drift from the original.
+type DeterminismChecker struct{}
+
+func (DeterminismChecker) Name() string {
+	return "determinism"
+}
+
+func (DeterminismChecker) Build(t *Test) bool {
+	dir := filepath.Join(t.path, regenDir)
+	prog0, err := t.generate()
+	if err != nil {
+		log.Printf("failed to generate program for seed %v: %v", t.seed, err)
+		return false
 	}
-	outbin := filepath.Join(t.path, "bin"+typ)
-	if _, err := os.Stat(outbin); err != nil {
+	if err := prog0.Write(dir); err != nil {
+		log.Printf("failed to write program for seed %v: %v", t.seed, err)
 		return false
 	}
-	cmd := exec.Command(outbin)
-	if goos == "nacl" {
-		cmd = exec.Command("bash", "go_nacl_"+goarch+"_exec", outbin)
+	prog, err := readProgram(t.path)
+	if err != nil {
+		log.Printf("failed to read program: %v", err)
+		return false
 	}
-	cmd.Env = []string{"GOMAXPROCS=2", "GOGC=0"}
-	cmd.Env = append(cmd.Env, os.Environ()...)
-	out, err := runWithTimeout(cmd)
-	if err == nil {
+	prog1, err := readProgram(dir)
+	if err != nil {
+		log.Printf("failed to read program: %v", err)
 		return false
 	}
-	for _, known := range knownExecBugs {
-		if known.Match(out) {
-			return false
+	var names []string
+	for name := range prog {
+		names = append(names, name)
+	}
+	for name := range prog1 {
+		if prog[name] == nil {
+			names = append(names, name)
 		}
 	}
-	outf, err := os.Create(filepath.Join(t.path, "exec."+typ))
+	sort.Strings(names)
+	var diff bytes.Buffer
+	for _, name := range names {
+		if !bytes.Equal(prog[name], prog1[name]) {
+			fmt.Fprintf(&diff, "%v differs\n", name)
+		}
+	}
+	if diff.Len() == 0 {
+		return false
+	}
+	t.saveFailure("determinism", diff.Bytes())
+	t.sig = "determinism: nondeterministic output"
+	log.Printf("nondeterministic output, seed %v\n", t.seed)
+	atomic.AddUint64(&statGenerator, 1)
+	return true
+}
+
+func (DeterminismChecker) Exec(t *Test) bool {
+	return false
+}
+
+func (DeterminismChecker) Cover(t *Test) bool {
+	return false
+}
+
+// saveFailure computes signature of the failure and writes the failure output
+// to the file name in the test dir.
+func (t *Test) saveFailure(name string, out []byte) {
+	t.sig = smith.Signature(name, out)
+	outf, err := os.Create(filepath.Join(t.path, name))
 	if err != nil {
 		log.Printf("failed to create output file: %v", err)
-	} else {
-		outf.Write(out)
-		outf.Close()
+		return
 	}
-	log.Printf("%v exec failed, seed %v\n", typ, t.seed)
-	atomic.AddUint64(&statExec, 1)
-	return true
+	outf.Write(out)
+	outf.Close()
 }
 
-func (t *Test) Ssadump() bool {
-	cmd := exec.Command("ssadump", "-build=CDPF", "main")
-	cmd.Env = []string{"GOPATH=" + t.gopath}
-	cmd.Env = append(cmd.Env, os.Environ()...)
-	out, err := cmd.CombinedOutput()
-	if err == nil {
-		return false
+// recordChecksum remembers the checksum printed by a safe program.
+func (t *Test) recordChecksum(typ string, out []byte) {
+	if !*safe {
+		return
 	}
-	for _, known := range knownSsadumpBugs {
-		if known.Match(out) {
-			atomic.AddUint64(&statKnown, 1)
-			return false
-		}
+	if t.checksums == nil {
+		t.checksums = make(map[string]smith.Checksum)
 	}
-	outf, err := os.Create(filepath.Join(t.path, "ssadump"))
-	if err != nil {
-		log.Printf("failed to create output file: %v", err)
-	} else {
-		outf.Write(out)
-		outf.Close()
+	sum, ok := smith.ParseChecksum(out)
+	if !ok {
+		sum = smith.Checksum{Sum: "missing", Float: "missing"}
 	}
-	log.Printf("ssadump failed, seed %v\n", t.seed)
-	atomic.AddUint64(&statSsadump, 1)
-	return true
+	t.checksums[typ] = sum
 }
 
-func (t *Test) SsadumpExec() bool {
-	cmd := exec.Command("ssadump", "-run", "main")
-	cmd.Env = []string{"GOPATH=" + t.gopath, "GOMAXPROCS=2", "GOGC=10"}
-	cmd.Env = append(cmd.Env, os.Environ()...)
-	out, err := cmd.CombinedOutput()
-	if err == nil {
+// CompareChecksums says whether the program computed different results
+// when built with different compilers, for different architectures or with different flags.
+func (t *Test) CompareChecksums() bool {
+	sig := smith.ChecksumSignature(t.checksums)
+	if sig == "" {
 		return false
 	}
-	for _, known := range knownExecBugs {
-		if known.Match(out) {
-			atomic.AddUint64(&statKnown, 1)
-			return false
-		}
+	// Signature is the partition of variants by computed result.
+	t.sig = sig
+	var typs []string
+	for typ := range t.checksums {
+		typs = append(typs, typ)
 	}
-	outf, err := os.Create(filepath.Join(t.path, "ssadump.run"))
+	sort.Strings(typs)
+	outf, err := os.Create(filepath.Join(t.path, "checksum"))
 	if err != nil {
 		log.Printf("failed to create output file: %v", err)
 	} else {
-		outf.Write(out)
+		for _, typ := range typs {
+			fmt.Fprintf(outf, "%v: %v float: %v\n", typ, t.checksums[typ].Sum, t.checksums[typ].Float)
+		}
 		outf.Close()
 	}
-	log.Printf("ssadump.run failed, seed %v\n", t.seed)
-	atomic.AddUint64(&statSsadump, 1)
+	log.Printf("checksum mismatch, seed %v\n", t.seed)
+	atomic.AddUint64(&statChecksum, 1)
 	return true
 }
 
 func (t *Test) Gofmt() bool {
 	files := []string{"main/0.go" /*, "main/1.go", "main/2.go", "a/0.go", "a/1.go", "a/2.go", "b/0.go", "b/1.go", "b/2.go"*/}
 	for _, f := range files {
-		if t.GofmtFile(filepath.Join(t.path, "src", f)) {
+		if t.GofmtFile(filepath.Join(t.srcDir(), f)) {
 			return true
 		}
 	}
@@ -474,7 +923,7 @@ func (t *Test) Gofmt() bool {
 }
 
 func (t *Test) GofmtFile(fname string) bool {
-	formatted, err := exec.Command("gofmt", fname).CombinedOutput()
+	formatted, err := runCommand(exec.Command("gofmt", fname))
 	if err != nil {
 		outf, err := os.Create(fname + ".gofmt")
 		if err != nil {
@@ -483,6 +932,7 @@ func (t *Test) GofmtFile(fname string) bool {
 			outf.Write(formatted)
 			outf.Close()
 		}
+		t.sig = smith.Signature("gofmt", formatted)
 		log.Printf("gofmt failed, seed %v\n", t.seed)
 		atomic.AddUint64(&statGofmt, 1)
 		return true
@@ -496,7 +946,7 @@ func (t *Test) GofmtFile(fname string) bool {
 	outf.Write(formatted)
 	outf.Close()
 
-	formatted2, err := exec.Command("gofmt", fname1).CombinedOutput()
+	formatted2, err := runCommand(exec.Command("gofmt", fname1))
 	if err != nil {
 		outf, err := os.Create(fname + ".gofmt")
 		if err != nil {
@@ -505,6 +955,7 @@ func (t *Test) GofmtFile(fname string) bool {
 			outf.Write(formatted2)
 			outf.Close()
 		}
+		t.sig = smith.Signature("gofmt", formatted2)
 		log.Printf("gofmt failed, seed %v\n", t.seed)
 		atomic.AddUint64(&statGofmt, 1)
 		return true
@@ -520,6 +971,7 @@ func (t *Test) GofmtFile(fname string) bool {
 	// Fails too often due to http://golang.org/issue/8021
 	if true {
 		if bytes.Compare(formatted, formatted2) != 0 {
+			t.sig = "gofmt: nonidempotent"
 			log.Printf("nonidempotent gofmt, seed %v\n", t.seed)
 			atomic.AddUint64(&statGofmt, 1)
 			return true
@@ -537,11 +989,12 @@ func (t *Test) GofmtFile(fname string) bool {
 	if err != nil {
 		log.Printf("failed to read file: %v", err)
 	}
-	stripped := bytes.Map(removeWs, origfile)
+	stripped := bytes.Map(removeWs, normalizeNumbers(origfile))
 	stripped2 := bytes.Map(removeWs, formatted)
 	if bytes.Compare(stripped, stripped2) != 0 {
 		writeStrippedFile(fname+".stripped0", stripped)
 		writeStrippedFile(fname+".stripped1", stripped2)
+		t.sig = "gofmt: corrupting"
 		log.Printf("corrupting gofmt, seed %v\n", t.seed)
 		atomic.AddUint64(&statGofmt, 1)
 		return true
@@ -549,6 +1002,211 @@ func (t *Test) GofmtFile(fname string) bool {
 	return false
 }
 
+// normalizeNumbers spells number literals in src the way gofmt does,
+// so that the legal spellings gosmith generates are not reported as corrupting gofmt.
+func normalizeNumbers(src []byte) []byte {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(src)), src, nil, 0)
+	var buf bytes.Buffer
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.INT && tok != token.FLOAT && tok != token.IMAG {
+			continue
+		}
+		off := fset.Position(pos).Offset
+		buf.Write(src[last:off])
+		buf.WriteString(normalizeNumber(lit))
+		last = off + len(lit)
+	}
+	buf.Write(src[last:])
+	return buf.Bytes()
+}
+
+// normalizeNumber is normalizedNumber from go/printer: it lowercases prefixes
+// and exponents and removes leading zeros from integer imaginary literals.
+func normalizeNumber(x string) string {
+	if len(x) < 2 {
+		return x
+	}
+	switch x[:2] {
+	default:
+		// 0-prefix octal, decimal int, or float (possibly with 'i' suffix).
+		if i := strings.LastIndexByte(x, 'E'); i >= 0 {
+			return x[:i] + "e" + x[i+1:]
+		}
+		if x[len(x)-1] == 'i' && !strings.ContainsAny(x, ".e") {
+			x = strings.TrimLeft(x, "0_")
+			if x == "i" {
+				x = "0i"
+			}
+		}
+	case "0X":
+		x = "0x" + x[2:]
+		if i := strings.LastIndexByte(x, 'P'); i >= 0 {
+			x = x[:i] + "p" + x[i+1:]
+		}
+	case "0x":
+		if i := strings.LastIndexByte(x, 'P'); i >= 0 {
+			x = x[:i] + "p" + x[i+1:]
+		}
+	case "0O":
+		x = "0o" + x[2:]
+	case "0B":
+		x = "0b" + x[2:]
+	case "0o", "0b":
+		// Already normalized, leading zeros must stay.
+	}
+	return x
+}
+
+// Bucket is a group of found bugs with the same signature.
+type Bucket struct {
+	sig   string
+	count int
+	seeds []string // saved bugs
+}
+
+// addFinding adds the bug found for the seed to the bucket with signature sig.
+// It says whether the test needs to be saved.
+func addFinding(sig, seed string) bool {
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	b := buckets[sig]
+	if b == nil {
+		b = &Bucket{sig: sig}
+		buckets[sig] = b
+	}
+	b.count++
+	if len(b.seeds) >= *bucketSize {
+		return false
+	}
+	b.seeds = append(b.seeds, seed)
+	return true
+}
+
+// loadBuckets adds bugs saved by previous runs to buckets.
+func loadBuckets() {
+	files, _ := filepath.Glob(filepath.Join(*workDir, "bug", "*", "signature"))
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			log.Printf("failed to read file: %v", err)
+			continue
+		}
+		addFinding(strings.TrimSpace(string(data)), filepath.Base(filepath.Dir(f)))
+	}
+}
+
+// sortedBuckets returns buckets sorted by number of bugs.
+func sortedBuckets() []*Bucket {
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	var list []*Bucket
+	for _, b := range buckets {
+		list = append(list, &Bucket{b.sig, b.count, append([]string{}, b.seeds...)})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].count != list[j].count {
+			return list[i].count > list[j].count
+		}
+		return list[i].sig < list[j].sig
+	})
+	return list
+}
+
+// bucketSummary returns counts of the n largest buckets for the status line.
+func bucketSummary(n int) string {
+	const maxLen = 60
+	list := sortedBuckets()
+	if len(list) == 0 {
+		return ""
+	}
+	res := fmt.Sprintf("; %v buckets:", len(list))
+	for i, b := range list {
+		if i == n {
+			res += " ..."
+			break
+		}
+		sig := b.sig
+		if len(sig) > maxLen {
+			sig = sig[:maxLen] + "..."
+		}
+		res += fmt.Sprintf(" %v %q", b.count, sig)
+	}
+	return res
+}
+
+// writeBuckets writes all buckets with saved seeds to workdir/buckets.
+func writeBuckets() {
+	f, err := os.Create(filepath.Join(*workDir, "buckets"))
+	if err != nil {
+		log.Printf("failed to create output file: %v", err)
+		return
+	}
+	defer f.Close()
+	for _, b := range sortedBuckets() {
+		fmt.Fprintf(f, "%v\t%v\t%v\n", b.count, b.sig, strings.Join(b.seeds, " "))
+	}
+}
+
+// addFeatures adds features of the generated program from its manifest to the totals.
+func (t *Test) addFeatures() {
+	data, err := ioutil.ReadFile(filepath.Join(t.path, "manifest.json"))
+	if err != nil {
+		log.Printf("failed to read manifest: %v", err)
+		return
+	}
+	var m smith.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		log.Printf("failed to parse manifest: %v", err)
+		return
+	}
+	featuresMu.Lock()
+	defer featuresMu.Unlock()
+	featurePrograms++
+	for _, f := range m.Packages {
+		features.Add(f)
+	}
+}
+
+// writeFeatures writes coverage of generated constructs to workdir/features,
+// constructs that were never generated are listed with zero counts.
+func writeFeatures() {
+	f, err := os.Create(filepath.Join(*workDir, "features"))
+	if err != nil {
+		log.Printf("failed to create output file: %v", err)
+		return
+	}
+	defer f.Close()
+	featuresMu.Lock()
+	defer featuresMu.Unlock()
+	fmt.Fprintf(f, "programs\t%v\n", featurePrograms)
+	for _, kind := range []struct {
+		name   string
+		names  []string
+		counts map[string]int
+	}{
+		{"statement", smith.StatementNames(), features.Statements},
+		{"expression", smith.ExpressionNames(), features.Expressions},
+		{"type", smith.ClassNames(), features.Types},
+	} {
+		for _, name := range kind.names {
+			fmt.Fprintf(f, "%v\t%v\t%v\n", kind.name, name, kind.counts[name])
+		}
+	}
+	fmt.Fprintf(f, "closures\t%v\n", features.Closures)
+	fmt.Fprintf(f, "goroutines\t%v\n", features.Goroutines)
+	fmt.Fprintf(f, "defers\t%v\n", features.Defers)
+	fmt.Fprintf(f, "crossrefs\t%v\n", features.CrossRefs)
+	fmt.Fprintf(f, "max block depth\t%v\n", features.MaxBlockDepth)
+	fmt.Fprintf(f, "max expr depth\t%v\n", features.MaxExprDepth)
+}
+
 func writeStrippedFile(fn string, data []byte) {
 	f, err := os.Create(fn)
 	if err != nil {
@@ -567,7 +1225,61 @@ func writeStrippedFile(fn string, data []byte) {
 	}
 }
 
+// runCommand runs cmd and returns its combined output.
+func runCommand(cmd *exec.Cmd) ([]byte, error) {
+	logCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	logOutput(out, err)
+	return out, err
+}
+
+// logCommand prints cmd in the form that can be pasted into shell in the verbose mode.
+// Only the environment variables set by the driver are printed.
+func logCommand(cmd *exec.Cmd) {
+	if !*verbose {
+		return
+	}
+	environ := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		environ[kv] = true
+	}
+	var words []string
+	if cmd.Dir != "" {
+		words = append(words, "cd", shellQuote(cmd.Dir), "&&")
+	}
+	for _, kv := range cmd.Env {
+		if !environ[kv] {
+			words = append(words, shellQuote(kv))
+		}
+	}
+	for _, arg := range cmd.Args {
+		words = append(words, shellQuote(arg))
+	}
+	log.Printf("+ %v", strings.Join(words, " "))
+}
+
+// logOutput prints output and exit status of a command in the verbose mode.
+func logOutput(out []byte, err error) {
+	if !*verbose {
+		return
+	}
+	if len(out) != 0 {
+		log.Printf("%s", out)
+	}
+	if err != nil {
+		log.Printf("command failed: %v", err)
+	}
+}
+
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\$`*?;&|<>()[]{}#~!") {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
 func runWithTimeout(cmd *exec.Cmd) ([]byte, error) {
+	logCommand(cmd)
 	var bufout bytes.Buffer
 	var buferr bytes.Buffer
 	cmd.Stdout = &bufout
@@ -590,5 +1302,7 @@ func runWithTimeout(cmd *exec.Cmd) ([]byte, error) {
 		cmd.Process.Signal(syscall.SIGTERM)
 	}()
 	err := cmd.Wait()
-	return []byte(bufout.String() + buferr.String()), err
+	out := []byte(bufout.String() + buferr.String())
+	logOutput(out, err)
+	return out, err
 }
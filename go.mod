@@ -0,0 +1,3 @@
+module github.com/dvyukov/gosmith
+
+go 1.20
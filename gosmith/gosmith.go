@@ -3,8 +3,10 @@ package main
 import (
 	"flag"
 	"fmt"
-	"math/rand"
 	"os"
+	"strings"
+
+	"github.com/dvyukov/gosmith/smith"
 )
 
 var (
@@ -12,6 +14,10 @@ var (
 	workdir    = flag.String("dir", "", "directory to write the program to")
 	singlepkg  = flag.Bool("singlepkg", false, "generate single-package program")
 	singlefile = flag.Bool("singlefile", false, "generate single-file packages")
+	safe       = flag.Bool("safe", false, "generate programs without undefined behavior")
+	gopath     = flag.Bool("gopath", false, "write the program in GOPATH layout (dir/src/main) instead of a module")
+	swarm      = flag.Bool("swarm", false, "disable a random subset of statements, expressions and types of the profile (saved in dir/profile.json)")
+	profile    = flag.String("profile", "default", "built-in profile ("+strings.Join(smith.ProfileNames(), ", ")+") or profile JSON file")
 )
 
 func main() {
@@ -20,6 +26,28 @@ func main() {
 		fmt.Fprintf(os.Stderr, "-dir flag is missing\n")
 		os.Exit(1)
 	}
-	rand.Seed(*seed)
-	writeProgram(*workdir)
+	prof, err := smith.LoadProfile(*profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	opts := smith.Options{
+		Safe:       *safe,
+		SinglePkg:  *singlepkg,
+		SingleFile: *singlefile,
+		GOPATH:     *gopath,
+		Profile:    prof,
+		Swarm:      *swarm,
+	}
+	prog := smith.NewGenerator(*seed, opts).Generate()
+	checkErr := prog.Check()
+	// The invalid program is still written, so that it can be inspected.
+	if err := prog.Write(*workdir); err != nil {
+		fmt.Fprintf(os.Stdout, "failed to write the program: %v\n", err)
+		os.Exit(1)
+	}
+	if checkErr != nil {
+		fmt.Fprintf(os.Stderr, "generated program is invalid: %v\n", checkErr)
+		os.Exit(smith.ExitInvalidProgram)
+	}
 }
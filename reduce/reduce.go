@@ -0,0 +1,622 @@
+package main
+
+/*
+Reduce minimizes a program found by the driver.
+Usage:
+go run reduce.go -checker=gc..386 work/bug/SEED
+
+Checker is the name of the failure output file in the bug directory:
+a build variant (gc..386, gccgo..amd64, gc..amd64.race, gc..amd64.noopt),
+exec.<variant>, cover.<variant>, ssadump, ssadump.run, checksum, types,
+types.gofmt or gosmith. The types and gosmith checkers use go/types on the
+program, gofmt and determinism failures can't be reduced.
+Reduce repeatedly deletes packages, files, declarations and statements
+while the same failure signature still reproduces, and writes the result
+to work/bug/SEED.reduced.
+*/
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dvyukov/gosmith/smith"
+)
+
+var (
+	checker = flag.String("checker", "", "failing checker (name of the failure output file in the bug dir)")
+	timeout = flag.Int64("timeout", 10, "task timeout in seconds")
+
+	fset     = token.NewFileSet()
+	packages = make(map[string]map[string]*ast.File) // package -> file name -> file
+	workDir  string
+	cacheDir string // GOCACHE of the driver: workdir/cache for work/bug/SEED
+	goMod    []byte // go.mod of the program, nil for the GOPATH layout
+	origSig  string
+	variants []string // build variants compared by the checksum checker
+	tested   = make(map[[sha256.Size]byte]bool)
+	nchecks  int
+	nreduced int                  // number of successful reductions
+	lists    map[interface{}]bool // lists attached to the program after nreduced reductions
+	listsGen = -1
+)
+
+func main() {
+	flag.Parse()
+	if *checker == "" || flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: reduce -checker=gc..amd64 work/bug/SEED\n")
+		os.Exit(1)
+	}
+	bugDir, err := filepath.Abs(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("failed to get absolute path: %v", err)
+	}
+	switch {
+	case *checker == "gofmt":
+		log.Fatalf("gofmt failures can't be reduced at AST level")
+	case *checker == "determinism":
+		log.Fatalf("determinism failures are generator bugs, replay the seed with the driver instead")
+	case *checker == "ssadump", *checker == "ssadump.run", *checker == "checksum",
+		*checker == "types", *checker == "types.gofmt", *checker == "gosmith":
+	default:
+		typ := strings.TrimPrefix(*checker, "exec.")
+		if len(strings.Split(strings.TrimPrefix(typ, "cover."), ".")) < 3 {
+			log.Fatalf("unknown checker %v", *checker)
+		}
+	}
+	if *checker == "checksum" {
+		variants = checksumVariants(filepath.Join(bugDir, "checksum"))
+	}
+	if goMod, err = ioutil.ReadFile(filepath.Join(bugDir, "go.mod")); err == nil {
+		parseProgram(bugDir)
+	} else {
+		goMod = nil
+		parseProgram(filepath.Join(bugDir, "src"))
+	}
+	workDir = bugDir + ".reduced"
+	cacheDir = filepath.Join(filepath.Dir(filepath.Dir(bugDir)), "cache")
+	os.RemoveAll(workDir)
+
+	before := programSize()
+	writeProgram()
+	failed, sig := check()
+	if !failed {
+		log.Fatalf("the failure does not reproduce")
+	}
+	// The driver saves the signature of the last failed checker,
+	// checksum signatures are checksum: or checksum.float: partitions.
+	if saved, err := ioutil.ReadFile(filepath.Join(bugDir, "signature")); err == nil {
+		savedSig := strings.TrimSpace(string(saved))
+		if (strings.HasPrefix(savedSig, *checker+": ") || *checker == "checksum" && strings.HasPrefix(savedSig, "checksum.")) && savedSig != sig {
+			log.Fatalf("the failure reproduces with a different signature: %v, saved: %v", sig, savedSig)
+		}
+	}
+	origSig = sig
+	log.Printf("reducing %v lines, signature: %v", before, origSig)
+
+	for changed := true; changed; {
+		changed = false
+		if reducePackages() {
+			changed = true
+		}
+		if reduceFiles() {
+			changed = true
+		}
+		for _, l := range collectLists() {
+			// The list could have been detached from the program by a previous reduction.
+			if attached(l) && reduceList(l) {
+				changed = true
+			}
+		}
+	}
+
+	// The last written program could be a rejected candidate.
+	writeProgram()
+	log.Printf("reduced %v lines to %v lines in %v checks, written to %v", before, programSize(), nchecks, workDir)
+}
+
+func parseProgram(src string) {
+	dirs, err := ioutil.ReadDir(src)
+	if err != nil {
+		log.Fatalf("failed to read program dir: %v", err)
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(src, d.Name(), "*.go"))
+		if err != nil {
+			log.Fatalf("failed to list files: %v", err)
+		}
+		if len(files) == 0 {
+			continue
+		}
+		pkg := make(map[string]*ast.File)
+		for _, fname := range files {
+			f, err := parser.ParseFile(fset, fname, nil, 0)
+			if err != nil {
+				log.Fatalf("failed to parse %v: %v", fname, err)
+			}
+			pkg[filepath.Base(fname)] = f
+		}
+		packages[d.Name()] = pkg
+	}
+	if packages["main"] == nil {
+		log.Fatalf("no main package in %v", src)
+	}
+}
+
+// checksumVariants returns build variants listed in the checksum failure file.
+func checksumVariants(fname string) []string {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		log.Fatalf("failed to read checksum file: %v", err)
+	}
+	var res []string
+	for _, ln := range strings.Split(string(data), "\n") {
+		if i := strings.Index(ln, ":"); i != -1 {
+			res = append(res, ln[:i])
+		}
+	}
+	return res
+}
+
+// render formats all files of the program.
+func render() map[string][]byte {
+	res := make(map[string][]byte)
+	for pname, pkg := range packages {
+		for fname, f := range pkg {
+			var buf bytes.Buffer
+			if err := format.Node(&buf, fset, pruneImports(f)); err != nil {
+				log.Fatalf("failed to format %v: %v", fname, err)
+			}
+			res[filepath.Join(pname, fname)] = buf.Bytes()
+		}
+	}
+	return res
+}
+
+// pruneImports returns a copy of f without unused imports,
+// so that declarations can be removed without the imports they use.
+func pruneImports(f *ast.File) *ast.File {
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+	f1 := *f
+	f1.Decls = nil
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			f1.Decls = append(f1.Decls, d)
+			continue
+		}
+		gd1 := *gd
+		gd1.Specs = nil
+		for _, spec := range gd.Specs {
+			imp := spec.(*ast.ImportSpec)
+			name := strings.Trim(imp.Path.Value, "\"")
+			name = name[strings.LastIndex(name, "/")+1:]
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			if used[name] || name == "_" {
+				gd1.Specs = append(gd1.Specs, spec)
+			}
+		}
+		if len(gd1.Specs) != 0 {
+			f1.Decls = append(f1.Decls, &gd1)
+		}
+	}
+	return &f1
+}
+
+func writeProgram() map[string][]byte {
+	os.RemoveAll(workDir)
+	files := render()
+	srcDir := filepath.Join(workDir, "src")
+	if goMod != nil {
+		srcDir = workDir
+		os.MkdirAll(workDir, os.ModePerm)
+		if err := ioutil.WriteFile(filepath.Join(workDir, "go.mod"), goMod, 0644); err != nil {
+			log.Fatalf("failed to write file: %v", err)
+		}
+	}
+	for fname, data := range files {
+		path := filepath.Join(srcDir, fname)
+		os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			log.Fatalf("failed to write file: %v", err)
+		}
+	}
+	return files
+}
+
+func programSize() int {
+	n := 0
+	for _, data := range render() {
+		n += bytes.Count(data, []byte{'\n'})
+	}
+	return n
+}
+
+// reproduces writes the current program and says whether it fails with the original signature.
+func reproduces() bool {
+	files := writeProgram()
+	var names []string
+	for fname := range files {
+		names = append(names, fname)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, fname := range names {
+		h.Write([]byte(fname))
+		h.Write(files[fname])
+	}
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+	if tested[key] {
+		return false
+	}
+	tested[key] = true
+	if failed, sig := check(); !failed || sig != origSig {
+		return false
+	}
+	nreduced++
+	return true
+}
+
+// check runs the checker on the written program.
+func check() (bool, string) {
+	nchecks++
+	switch {
+	case *checker == "ssadump":
+		return failure(run(command("", "", "ssadump", "-build=CDPF", pkg("main"))))
+	case *checker == "ssadump.run":
+		return failure(run(command("", "", "ssadump", "-run", pkg("main"))))
+	case *checker == "checksum":
+		return checkChecksum()
+	case *checker == "types", *checker == "types.gofmt":
+		// Written files are formatted, so they are the gofmt-ed variant as well.
+		return checkTypes()
+	case *checker == "gosmith":
+		if err := smith.Program(render()).Check(); err != nil {
+			return true, smith.Signature(*checker, []byte(fmt.Sprintf("generated program is invalid: %v\n", err)))
+		}
+		return false, ""
+	case strings.HasPrefix(*checker, "exec."):
+		typ := strings.TrimPrefix(*checker, "exec.")
+		if failed, _ := failure(build(typ)); failed {
+			return false, ""
+		}
+		return failure(execute(typ))
+	default:
+		return failure(build(*checker))
+	}
+}
+
+// checkTypes says whether gc and go/types disagree about the program,
+// the signature is the same the driver computes.
+func checkTypes() (bool, string) {
+	var typesOut bytes.Buffer
+	for _, err := range smith.Program(render()).Errors() {
+		fmt.Fprintf(&typesOut, "%v\n", err)
+	}
+	gcOut, err := run(command("", "", "go", "build", "-o", os.DevNull, pkg("main")))
+	verdict, out := smith.TypesVerdict(gcOut, err == nil, typesOut.Bytes())
+	if verdict == "" {
+		return false, ""
+	}
+	return true, smith.Signature(*checker+": "+verdict, out)
+}
+
+// checkChecksum says whether the build variants print different checksums,
+// the signature is the same the driver computes.
+func checkChecksum() (bool, string) {
+	sums := make(map[string]smith.Checksum)
+	for _, typ := range variants {
+		var out []byte
+		var err error
+		if typ == "ssa" {
+			out, err = run(command("", "", "ssadump", "-run", pkg("main")))
+		} else {
+			if failed, _ := failure(build(typ)); failed {
+				return false, ""
+			}
+			out, err = execute(typ)
+		}
+		sum, ok := smith.ParseChecksum(out)
+		if err != nil || !ok {
+			return false, ""
+		}
+		sums[typ] = sum
+	}
+	sig := smith.ChecksumSignature(sums)
+	return sig != "", sig
+}
+
+func binary(typ string) string {
+	return filepath.Join(workDir, "bin"+typ)
+}
+
+// execute runs the binary built for the variant typ the same way the driver does.
+func execute(typ string) ([]byte, error) {
+	cmd := exec.Command(binary(typ))
+	cmd.Env = append(os.Environ(), "GOMAXPROCS=2", "GOGC=0")
+	return run(cmd)
+}
+
+// build builds the program for the variant typ, e.g. gc..386.race.
+// Variants with the cover. prefix build the coverage test binary of package a.
+func build(typ string) ([]byte, error) {
+	cover := strings.HasPrefix(typ, "cover.")
+	parts := strings.Split(strings.TrimPrefix(typ, "cover."), ".")
+	if len(parts) < 3 {
+		log.Fatalf("unknown checker %v", typ)
+	}
+	compiler, goos, goarch := parts[0], parts[1], parts[2]
+	args := []string{"build", "-o", binary(typ)}
+	if cover {
+		args = []string{"test", "-c", "-cover", "-o", binary(typ)}
+	}
+	args = append(args, "-compiler", compiler)
+	for _, p := range parts[3:] {
+		switch p {
+		case "race":
+			args = append(args, "-race")
+		case "noopt":
+			args = append(args, "-gcflags=-N -l")
+		default:
+			log.Fatalf("unknown checker %v", typ)
+		}
+	}
+	if cover {
+		args = append(args, pkg("a"))
+	} else {
+		args = append(args, pkg("main"))
+	}
+	return run(command(goos, goarch, "go", args...))
+}
+
+// pkg returns the go tool argument for the package name.
+func pkg(name string) string {
+	if goMod == nil {
+		return name
+	}
+	return "./" + name
+}
+
+// command returns the command with the environment the driver uses.
+func command(goos, goarch, bin string, args ...string) *exec.Cmd {
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = workDir
+	// Later values take precedence.
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOCACHE="+cacheDir, "GOMAXPROCS=2")
+	if goMod == nil {
+		cmd.Env = append(cmd.Env, "GOPATH="+workDir, "GO111MODULE=off")
+	} else {
+		cmd.Env = append(cmd.Env, "GO111MODULE=on", "GOWORK=off", "GOTOOLCHAIN=local")
+	}
+	if goarch != "" {
+		cmd.Env = append(cmd.Env, "GOARCH="+goarch)
+	}
+	if goos != "" {
+		cmd.Env = append(cmd.Env, "GOOS="+goos)
+	}
+	return cmd
+}
+
+// failure returns whether the command failed and signature of the failure,
+// the same signature the driver computes for the checker.
+func failure(out []byte, err error) (bool, string) {
+	if err == nil {
+		return false, ""
+	}
+	return true, smith.Signature(*checker, out)
+}
+
+// reducePackages tries to remove whole packages except main.
+func reducePackages() bool {
+	var names []string
+	for name := range packages {
+		if name != "main" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	res := false
+	for _, name := range names {
+		pkg := packages[name]
+		delete(packages, name)
+		if reproduces() {
+			res = true
+			continue
+		}
+		packages[name] = pkg
+	}
+	return res
+}
+
+// reduceFiles tries to remove single files.
+func reduceFiles() bool {
+	var pnames []string
+	for name := range packages {
+		pnames = append(pnames, name)
+	}
+	sort.Strings(pnames)
+	res := false
+	for _, pname := range pnames {
+		pkg := packages[pname]
+		var fnames []string
+		for fname := range pkg {
+			fnames = append(fnames, fname)
+		}
+		sort.Strings(fnames)
+		for _, fname := range fnames {
+			if len(pkg) == 1 {
+				break
+			}
+			f := pkg[fname]
+			delete(pkg, fname)
+			if reproduces() {
+				res = true
+				continue
+			}
+			pkg[fname] = f
+		}
+	}
+	return res
+}
+
+// collectLists returns pointers to all lists of declarations, specs and statements
+// in the program, outer lists go first.
+func collectLists() []interface{} {
+	var lists []interface{}
+	var pnames []string
+	for name := range packages {
+		pnames = append(pnames, name)
+	}
+	sort.Strings(pnames)
+	for _, pname := range pnames {
+		var fnames []string
+		for fname := range packages[pname] {
+			fnames = append(fnames, fname)
+		}
+		sort.Strings(fnames)
+		for _, fname := range fnames {
+			ast.Inspect(packages[pname][fname], func(n ast.Node) bool {
+				switch x := n.(type) {
+				case *ast.File:
+					lists = append(lists, &x.Decls)
+				case *ast.GenDecl:
+					lists = append(lists, &x.Specs)
+				case *ast.BlockStmt:
+					lists = append(lists, &x.List)
+				case *ast.CaseClause:
+					lists = append(lists, &x.Body)
+				case *ast.CommClause:
+					lists = append(lists, &x.Body)
+				}
+				return true
+			})
+		}
+	}
+	return lists
+}
+
+func attached(l interface{}) bool {
+	if listsGen != nreduced {
+		listsGen = nreduced
+		lists = make(map[interface{}]bool)
+		for _, l1 := range collectLists() {
+			lists[l1] = true
+		}
+	}
+	return lists[l]
+}
+
+// reduceList removes chunks of elements of the list l (a pointer to a slice)
+// starting with halves of the list down to single elements.
+// Statements with bodies are also replaced with their bodies.
+func reduceList(l interface{}) bool {
+	v := reflect.ValueOf(l).Elem()
+	res := false
+	for chunk := (v.Len() + 1) / 2; chunk >= 1; chunk /= 2 {
+		for i := 0; i+chunk <= v.Len(); {
+			orig := v.Interface()
+			rest := reflect.MakeSlice(v.Type(), 0, v.Len()-chunk)
+			rest = reflect.AppendSlice(rest, v.Slice(0, i))
+			rest = reflect.AppendSlice(rest, v.Slice(i+chunk, v.Len()))
+			v.Set(rest)
+			if reproduces() {
+				res = true
+				continue
+			}
+			v.Set(reflect.ValueOf(orig))
+			i += chunk
+		}
+	}
+	if stmts, ok := l.(*[]ast.Stmt); ok {
+		for i := 0; i < len(*stmts); i++ {
+			body := stmtBody((*stmts)[i])
+			if body == nil {
+				continue
+			}
+			orig := *stmts
+			list := append([]ast.Stmt{}, orig[:i]...)
+			list = append(list, body...)
+			list = append(list, orig[i+1:]...)
+			*stmts = list
+			if reproduces() {
+				res = true
+				continue
+			}
+			*stmts = orig
+		}
+	}
+	return res
+}
+
+// stmtBody returns statements that s can be replaced with.
+func stmtBody(s ast.Stmt) []ast.Stmt {
+	switch x := s.(type) {
+	case *ast.BlockStmt:
+		return x.List
+	case *ast.IfStmt:
+		return x.Body.List
+	case *ast.ForStmt:
+		return x.Body.List
+	case *ast.RangeStmt:
+		return x.Body.List
+	case *ast.LabeledStmt:
+		return []ast.Stmt{x.Stmt}
+	}
+	return nil
+}
+
+func run(cmd *exec.Cmd) ([]byte, error) {
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Duration(*timeout) * time.Second):
+		}
+		cmd.Process.Signal(syscall.SIGABRT)
+		select {
+		case <-done:
+			return
+		case <-time.After(5 * time.Second):
+		}
+		cmd.Process.Signal(syscall.SIGTERM)
+	}()
+	err := cmd.Wait()
+	return buf.Bytes(), err
+}
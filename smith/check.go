@@ -0,0 +1,113 @@
+package smith
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ExitInvalidProgram is the exit status of gosmith when the generated program
+// does not type-check, the driver counts such failures as generator bugs.
+const ExitInvalidProgram = 3
+
+// Check parses and type-checks the program the same way the compiler does.
+// A non-nil error means a bug in the generator, the error contains position
+// of the first invalid construct.
+func (p Program) Check() error {
+	if errs := p.Errors(); len(errs) != 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Errors type-checks the program and returns all errors in the order they are found.
+// Packages that depend on an invalid package are not checked.
+func (p Program) Errors() []error {
+	c := &checker{
+		fset:     token.NewFileSet(),
+		files:    make(map[string][]*ast.File),
+		pkgs:     make(map[string]*types.Package),
+		checking: make(map[string]bool),
+		importer: importer.Default(),
+	}
+	var names []string
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var dirs []string
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(c.fset, name, p[name], 0)
+		if err != nil {
+			return []error{err}
+		}
+		dir := path.Dir(name)
+		if c.files[dir] == nil {
+			dirs = append(dirs, dir)
+		}
+		c.files[dir] = append(c.files[dir], f)
+	}
+	for _, dir := range dirs {
+		c.check(dir)
+	}
+	return c.errs
+}
+
+// checker type-checks packages of the program in dependency order.
+type checker struct {
+	fset     *token.FileSet
+	files    map[string][]*ast.File    // package dir -> files
+	pkgs     map[string]*types.Package // nil for invalid packages
+	checking map[string]bool           // import cycle detection
+	importer types.Importer
+	errs     []error
+}
+
+func (c *checker) check(dir string) *types.Package {
+	if pkg, ok := c.pkgs[dir]; ok {
+		return pkg
+	}
+	if c.checking[dir] {
+		c.fail(fmt.Errorf("import cycle through package %v", dir))
+		return nil
+	}
+	c.checking[dir] = true
+	defer delete(c.checking, dir)
+	conf := types.Config{
+		Importer:  c,
+		GoVersion: "go" + GoVersion,
+		Error:     c.fail,
+	}
+	pkg, err := conf.Check(path.Base(dir), c.fset, c.files[dir], nil)
+	if err != nil {
+		pkg = nil
+	}
+	c.pkgs[dir] = pkg
+	return pkg
+}
+
+func (c *checker) fail(err error) {
+	c.errs = append(c.errs, err)
+}
+
+// Import resolves imports of generated packages to the program packages.
+func (c *checker) Import(imp string) (*types.Package, error) {
+	for dir := range c.files {
+		if imp == ModulePath+"/"+dir || imp == strings.TrimPrefix(dir, "src/") {
+			if pkg := c.check(dir); pkg != nil {
+				return pkg, nil
+			}
+			return nil, fmt.Errorf("package %v is invalid", imp)
+		}
+	}
+	return c.importer.Import(imp)
+}
@@ -0,0 +1,44 @@
+package smith
+
+import "testing"
+
+// TestCheck checks that generated programs type-check.
+func TestCheck(t *testing.T) {
+	huge, err := LoadProfile("huge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeds := func(n int64) []int64 {
+		var res []int64
+		for seed := int64(1); seed <= n; seed++ {
+			res = append(res, seed)
+		}
+		return res
+	}
+	n := int64(50)
+	if testing.Short() {
+		n = 10
+	}
+	tests := []struct {
+		name  string
+		opts  Options
+		seeds []int64
+	}{
+		{"default", Options{}, seeds(n)},
+		{"safe", Options{Safe: true}, seeds(n)},
+		{"swarm", Options{Swarm: true}, seeds(n)},
+		// Huge programs contain rare constructs, like method values of named function types.
+		{"huge", Options{Profile: huge}, []int64{5, 24}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			for _, seed := range test.seeds {
+				if err := NewGenerator(seed, test.opts).Generate().Check(); err != nil {
+					t.Errorf("seed %v: %v", seed, err)
+				}
+			}
+		})
+	}
+}
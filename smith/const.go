@@ -0,0 +1,337 @@
+package smith
+
+import (
+	"go/constant"
+	"go/token"
+	"math/big"
+)
+
+// Constant expressions are generated together with their values,
+// so that we never emit a constant that overflows its type.
+
+// basicType returns the predeclared underlying type of t if it is
+// a boolean, numeric or string type, or nil otherwise.
+func (g *Generator) basicType(t *Type) *Type {
+	u := t.utyp
+	if u == nil || !g.satisfiesTrait(u, TraitGlobal) || u.class == ClassInterface {
+		return nil
+	}
+	return u
+}
+
+func (g *Generator) isFloat(t *Type) bool {
+	return t == g.float32Type || t == g.float64Type
+}
+
+// intSize returns the size in bits and signedness of the integer type t.
+// int, uint and uintptr are 32 bits, so that the program builds for all architectures.
+func intSize(t *Type) (bits uint, signed bool) {
+	switch t.id {
+	case "int8":
+		return 8, true
+	case "int16":
+		return 16, true
+	case "int", "int32", "rune":
+		return 32, true
+	case "int64":
+		return 64, true
+	case "byte", "uint8":
+		return 8, false
+	case "uint16":
+		return 16, false
+	case "uint", "uint32", "uintptr":
+		return 32, false
+	case "uint64":
+		return 64, false
+	default:
+		panic("bad")
+	}
+}
+
+// intRange returns bounds of the integer type t.
+func intRange(t *Type) (min, max constant.Value) {
+	bits, signed := intSize(t)
+	one := constant.MakeInt64(1)
+	if signed {
+		bound := constant.Shift(one, token.SHL, bits-1)
+		return constant.UnaryOp(token.SUB, bound, 0), constant.BinaryOp(bound, token.SUB, one)
+	}
+	return constant.MakeInt64(0), constant.BinaryOp(constant.Shift(one, token.SHL, bits), token.SUB, one)
+}
+
+// constValid says whether v is a good value for a constant expression of type t.
+// If typed is not set, v is an untyped constant that is not converted to t.
+func (g *Generator) constValid(v constant.Value, t *Type, typed bool) bool {
+	b := g.basicType(t)
+	switch {
+	case b == nil:
+		return false
+	case b.class == ClassBoolean:
+		return v.Kind() == constant.Bool
+	case b.class == ClassString:
+		return v.Kind() == constant.String
+	case g.isFloat(b):
+		// Keep floats exactly representable in float32,
+		// so that typed float constants are never rounded.
+		if v.Kind() != constant.Int && v.Kind() != constant.Float {
+			return false
+		}
+		x := constant.ToInt(constant.BinaryOp(v, token.MUL, constant.MakeInt64(16)))
+		return x.Kind() == constant.Int &&
+			constant.Compare(x, token.LEQ, constant.MakeInt64(1<<23)) &&
+			constant.Compare(x, token.GEQ, constant.MakeInt64(-1<<23))
+	case b.class == ClassNumeric:
+		if v.Kind() != constant.Int || constant.BitLen(v) > 200 {
+			return false
+		}
+		if !typed {
+			return true
+		}
+		min, max := intRange(b)
+		return constant.Compare(v, token.GEQ, min) && constant.Compare(v, token.LEQ, max)
+	default:
+		return false
+	}
+}
+
+// fmtConst formats the constant value v as a literal.
+func (g *Generator) fmtConst(v constant.Value) string {
+	switch v.Kind() {
+	case constant.Bool:
+		return v.ExactString()
+	case constant.String:
+		return g.fmtString(constant.StringVal(v))
+	case constant.Int:
+		return g.fmtInt(v, true)
+	case constant.Float:
+		return g.fmtFloat(v)
+	default:
+		panic("bad")
+	}
+}
+
+func constBigInt(v constant.Value) *big.Int {
+	switch x := constant.Val(v).(type) {
+	case int64:
+		return big.NewInt(x)
+	case *big.Int:
+		return x
+	default:
+		panic("bad")
+	}
+}
+
+// constExpr returns a constant expression convertible to type t and its value.
+// If typed is set, the expression can refer to constants of type t
+// and then it has type t itself, which is reported in the last result.
+func (g *Generator) constExpr(t *Type, typed bool, depth int) (string, constant.Value, bool) {
+	if depth >= 2 || g.rndBool() {
+		return g.constLeaf(t, typed)
+	}
+	b := g.basicType(t)
+	s0, v0, typed0 := g.constExpr(t, typed, depth+1)
+	s, v, isTyped := "", constant.Value(nil), typed0
+	switch {
+	case b.class == ClassBoolean:
+		switch op := g.choice("!", "&&", "||", "==", "!=", "<", "<="); op {
+		case "!":
+			s, v = F("!(%v)", s0), constant.UnaryOp(token.NOT, v0, 0)
+		case "&&", "||":
+			s1, v1, typed1 := g.constExpr(t, typed, depth+1)
+			s, v, isTyped = F("(%v) %v (%v)", s0, op, s1), constant.BinaryOp(v0, constToken(op), v1), typed0 || typed1
+		case "==", "!=":
+			s1, v1, _ := g.constExpr(t, typed, depth+1)
+			s, v, isTyped = F("(%v) %v (%v)", s0, op, s1), constant.MakeBool(constant.Compare(v0, constToken(op), v1)), false
+		case "<", "<=":
+			s0, v0, _ = g.constExpr(g.intType, false, depth+1)
+			s1, v1, _ := g.constExpr(g.intType, false, depth+1)
+			s, v, isTyped = F("(%v) %v (%v)", s0, op, s1), constant.MakeBool(constant.Compare(v0, constToken(op), v1)), false
+		default:
+			panic("bad")
+		}
+	case b.class == ClassString:
+		s1, v1, typed1 := g.constExpr(t, typed, depth+1)
+		s, v, isTyped = F("(%v) + (%v)", s0, s1), constant.BinaryOp(v0, token.ADD, v1), typed0 || typed1
+	case g.isFloat(b):
+		switch op := g.choice("-", "+", "-", "*"); op {
+		case "-":
+			if g.rndBool() {
+				s, v = F("-(%v)", s0), constant.UnaryOp(token.SUB, v0, 0)
+				break
+			}
+			fallthrough
+		default:
+			s1, v1, typed1 := g.constExpr(t, typed, depth+1)
+			s, v, isTyped = F("(%v) %v (%v)", s0, op, s1), constant.BinaryOp(v0, constToken(op), v1), typed0 || typed1
+		}
+	default:
+		switch op := g.choice("+", "-", "*", "/", "%", "&", "|", "^", "&^", "<<", ">>", "unary"); op {
+		case "unary":
+			op = g.choice("-", "+", "^")
+			if _, signed := intSize(b); op == "^" && typed0 && !signed {
+				// Complement of unsigned constants depends on the type size.
+				op = "-"
+			}
+			s, v = F("%v(%v)", op, s0), constant.UnaryOp(constToken(op), v0, 0)
+		case "<<", ">>":
+			n := g.rnd(8)
+			if !typed {
+				n = g.rnd(70)
+			}
+			s, v = F("(%v) %v %v", s0, op, n), constant.Shift(v0, constToken(op), uint(n))
+		default:
+			s1, v1, typed1 := g.constExpr(t, typed, depth+1)
+			if (op == "/" || op == "%") && constant.Sign(v1) == 0 {
+				return s0, v0, typed0
+			}
+			s, v, isTyped = F("(%v) %v (%v)", s0, op, s1), constant.BinaryOp(v0, constToken(op), v1), typed0 || typed1
+		}
+	}
+	if !g.constValid(v, t, typed) {
+		return s0, v0, typed0
+	}
+	return s, v, isTyped
+}
+
+func constToken(op string) token.Token {
+	switch op {
+	case "+":
+		return token.ADD
+	case "-":
+		return token.SUB
+	case "*":
+		return token.MUL
+	case "/":
+		// Integer division.
+		return token.QUO_ASSIGN
+	case "%":
+		return token.REM
+	case "&":
+		return token.AND
+	case "|":
+		return token.OR
+	case "^":
+		return token.XOR
+	case "&^":
+		return token.AND_NOT
+	case "<<":
+		return token.SHL
+	case ">>":
+		return token.SHR
+	case "!":
+		return token.NOT
+	case "&&":
+		return token.LAND
+	case "||":
+		return token.LOR
+	case "==":
+		return token.EQL
+	case "!=":
+		return token.NEQ
+	case "<":
+		return token.LSS
+	case "<=":
+		return token.LEQ
+	default:
+		panic("bad")
+	}
+}
+
+func (g *Generator) constLeaf(t *Type, typed bool) (string, constant.Value, bool) {
+	var cand []*Const
+	for _, c := range g.consts() {
+		if c.typ == nil && g.constValid(c.val, t, typed) || typed && c.typ != nil && c.typ.id == t.id {
+			cand = append(cand, c)
+		}
+	}
+	if len(cand) != 0 && g.rnd(4) != 0 {
+		c := cand[g.rnd(len(cand))]
+		return c.id, c.val, c.typ != nil
+	}
+	b := g.basicType(t)
+	var v constant.Value
+	switch {
+	case b.class == ClassBoolean:
+		v = constant.MakeBool(g.rndBool())
+	case b.class == ClassString:
+		v = constant.MakeString(g.stringValue())
+	case g.isFloat(b):
+		v = constant.MakeFloat64(float64(g.rnd(2001)-1000) / float64(int(1)<<uint(g.rnd(5))))
+	default:
+		switch g.choice("small", "min", "max", "big") {
+		case "small":
+			v = constant.MakeInt64(int64(g.rnd(20) - 10))
+		case "min", "max":
+			min, max := intRange(b)
+			v = min
+			if g.rndBool() {
+				v = max
+			}
+		case "big":
+			v = constant.Shift(constant.MakeInt64(1), token.SHL, uint(g.rnd(100)))
+		}
+		if !g.constValid(v, t, typed) {
+			v = constant.MakeInt64(int64(g.rnd(8)))
+		}
+	}
+	return g.fmtConst(v), v, false
+}
+
+// constType returns type for a new constant, and whether the constant is typed.
+func (g *Generator) constType() (*Type, bool) {
+	if g.rndBool() {
+		var cand []*Type
+		for _, t := range g.types() {
+			if b := g.basicType(t); b != nil && b.class != ClassComplex {
+				cand = append(cand, t)
+			}
+		}
+		return cand[g.rnd(len(cand))], true
+	}
+	switch g.choice("int", "float", "string", "bool") {
+	case "int":
+		return g.intType, false
+	case "float":
+		return g.float64Type, false
+	case "string":
+		return g.stringType, false
+	case "bool":
+		return g.boolType, false
+	default:
+		panic("bad")
+	}
+}
+
+// iotaExpr returns an expression with iota for a typed or untyped constant of type t
+// with the given number of specs, and the constants values.
+func (g *Generator) iotaExpr(t *Type, typed bool, n int) (string, []constant.Value) {
+	c := int64(g.rnd(20) - 10)
+	k := int64(g.rnd(5) + 1)
+	for {
+		var s string
+		var f func(i int64) int64
+		switch g.choice("iota", "add", "mul", "sub", "shift", "rem") {
+		case "iota":
+			s, f = "iota", func(i int64) int64 { return i }
+		case "add":
+			s, f = F("iota + %v", g.fmtConst(constant.MakeInt64(c))), func(i int64) int64 { return i + c }
+		case "mul":
+			s, f = F("iota * %v + %v", k, g.fmtConst(constant.MakeInt64(c))), func(i int64) int64 { return i*k + c }
+		case "sub":
+			s, f = F("%v - iota", g.fmtConst(constant.MakeInt64(c))), func(i int64) int64 { return c - i }
+		case "shift":
+			s, f = F("%v << iota", k), func(i int64) int64 { return k << uint(i) }
+		case "rem":
+			s, f = F("(iota + %v) %% %v", k, k+1), func(i int64) int64 { return (i + k) % (k + 1) }
+		}
+		vals := make([]constant.Value, n)
+		ok := true
+		for i := range vals {
+			vals[i] = constant.MakeInt64(f(int64(i)))
+			ok = ok && g.constValid(vals[i], t, typed)
+		}
+		if ok {
+			return s, vals
+		}
+	}
+}
@@ -0,0 +1,952 @@
+// Package smith generates random, but legal, Go programs to test Go compilers.
+// The gosmith command is a thin wrapper around it.
+package smith
+
+/*
+Large uncovered parts are:
+- type assignability and identity
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"go/constant"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	ModulePath = "prog" // module path of generated programs
+	GoVersion  = "1.20" // language version of generated programs, interfaces satisfy comparable since 1.20
+
+	// Version is the generator version, it is incremented
+	// when the same seed and options generate a different program.
+	Version = 8
+)
+
+type Package struct {
+	name    string
+	imports map[string]bool
+	top     *Block
+
+	undefFuncs []*Func
+	undefVars  []*Var
+
+	toplevVars   []*Var
+	toplevFuncs  []*Func
+	toplevTypes  []*Type
+	toplevConsts []*Const
+
+	generics     []*Type // generic types
+	genericFuncs []*Func // generic functions, including ones in imported packages
+	constraints  []*Type // named constraint interfaces
+
+	features Features
+}
+
+type Block struct {
+	str           string
+	parent        *Block
+	subBlock      *Block
+	extendable    bool
+	isBreakable   bool
+	isContinuable bool
+	funcBoundary  bool
+	sub           []*Block
+	consts        []*Const
+	types         []*Type
+	funcs         []*Func
+	vars          []*Var
+}
+
+type Func struct {
+	name     string
+	args     []*Type
+	rets     []*Type
+	recv     *Type   // receiver base type, non-nil for methods
+	ptrRecv  bool    // method is declared on *recv
+	tparams  []*Type // type parameters of a generic function
+	variadic bool    // the last of args is []T passed as ...T
+}
+
+type Var struct {
+	id    string
+	typ   *Type
+	block *Block
+	used  bool
+}
+
+type Const struct {
+	id  string
+	typ *Type // nil for untyped constants
+	val constant.Value
+}
+
+// Options control the shape of generated programs.
+type Options struct {
+	Safe       bool     // generate programs without undefined behavior
+	SinglePkg  bool     // generate single-package program
+	SingleFile bool     // generate single-file packages
+	GOPATH     bool     // use GOPATH layout (src/main) instead of a module
+	Profile    *Profile // construct weights and sizes, DefaultProfile if nil
+	Swarm      bool     // disable a random subset of constructs of the profile
+}
+
+// Generator generates a random program. All generator state is kept
+// in the Generator, so several generators can run concurrently.
+type Generator struct {
+	opts Options
+	prof *Profile
+	seed int64
+	rand *rand.Rand
+
+	curPackage  int
+	curBlock    *Block
+	curBlockPos int
+	curFunc     *Func
+
+	packages []*Package // main is the first, nil if not generated
+
+	idSeq          int
+	typeDepth      int
+	stmtCount      int
+	exprDepth      int
+	exprCount      int
+	totalExprCount int
+
+	predefinedTypes []*Type
+	stringType      *Type
+	boolType        *Type
+	intType         *Type
+	byteType        *Type
+	efaceType       *Type
+	errorType       *Type
+	runeType        *Type
+	float32Type     *Type
+	float64Type     *Type
+	complex64Type   *Type
+	complex128Type  *Type
+
+	anyConstraint        *Type
+	comparableConstraint *Type
+
+	statements  []stmtKind
+	expressions []exprKind
+	stmtWeights []int
+	exprWeights []int
+	typeWeights []int
+
+	// Methods are called through interfaces only if no method with the same
+	// name is being generated, and no new methods with that name are declared
+	// afterwards. This ensures that dynamic dispatch can't lead to recursion.
+	methodsInProgress map[string]int
+	dispatchedMethods map[string]bool
+}
+
+// Program is a generated program: file contents keyed by slash-separated path
+// relative to the program root.
+type Program map[string][]byte
+
+// NewGenerator returns a generator of a single program for the seed.
+func NewGenerator(seed int64, opts Options) *Generator {
+	prof := opts.Profile
+	if prof == nil {
+		prof = DefaultProfile()
+	}
+	return &Generator{
+		opts:              opts,
+		prof:              prof,
+		seed:              seed,
+		rand:              rand.New(rand.NewSource(seed)),
+		methodsInProgress: make(map[string]int),
+		dispatchedMethods: make(map[string]bool),
+	}
+}
+
+// Generate generates the program. It must be called only once.
+func (g *Generator) Generate() Program {
+	if g.opts.Swarm {
+		g.swarm()
+	}
+	g.initTypes()
+	g.initExpressions()
+	g.initStatements()
+	g.initProgram()
+	for pi := range g.packages {
+		g.genPackage(pi)
+	}
+	prog := g.serializeProgram()
+	prog["manifest.json"] = g.manifest()
+	if g.opts.Swarm {
+		// Bug reports state which features were present.
+		prog["profile.json"] = g.prof.JSON()
+	}
+	return prog
+}
+
+// Write writes the program files into dir.
+func (p Program) Write(dir string) error {
+	for path, data := range p {
+		fname := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fname), os.ModePerm); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Generator) initProgram() {
+	g.packages = make([]*Package, g.prof.Packages)
+	g.packages[0] = newPackage("main")
+	g.packages[0].undefFuncs = []*Func{
+		&Func{name: "init", args: []*Type{}, rets: []*Type{}},
+		&Func{name: "init", args: []*Type{}, rets: []*Type{}},
+		&Func{name: "main", args: []*Type{}, rets: []*Type{}},
+	}
+	if !g.opts.SinglePkg {
+		for i := 1; i < len(g.packages); i++ {
+			g.packages[i] = newPackage(string(rune('a' + i - 1)))
+		}
+	}
+}
+
+func newPackage(name string) *Package {
+	return &Package{name: name, imports: make(map[string]bool), top: &Block{extendable: true}}
+}
+
+func (g *Generator) genPackage(pi int) {
+	g.typeDepth = 0
+	g.stmtCount = 0
+	g.exprDepth = 0
+	g.exprCount = 0
+	g.totalExprCount = 0
+
+	p := g.packages[pi]
+	if p == nil {
+		return
+	}
+	for len(p.undefFuncs) != 0 || len(p.undefVars) != 0 {
+		if len(p.undefFuncs) != 0 {
+			f := p.undefFuncs[len(p.undefFuncs)-1]
+			p.undefFuncs = p.undefFuncs[:len(p.undefFuncs)-1]
+			g.genToplevFunction(pi, f)
+		}
+		if len(p.undefVars) != 0 {
+			v := p.undefVars[len(p.undefVars)-1]
+			p.undefVars = p.undefVars[:len(p.undefVars)-1]
+			g.genToplevVar(pi, v)
+		}
+	}
+}
+
+func F(f string, args ...interface{}) string {
+	return fmt.Sprintf(f, args...)
+}
+
+func (g *Generator) line(f string, args ...interface{}) {
+	s := F(f, args...)
+	b := &Block{parent: g.curBlock, str: s}
+	if g.curBlockPos+1 == len(g.curBlock.sub) {
+		g.curBlock.sub = append(g.curBlock.sub, b)
+	} else {
+		g.curBlock.sub = append(g.curBlock.sub, nil)
+		copy(g.curBlock.sub[g.curBlockPos+2:], g.curBlock.sub[g.curBlockPos+1:])
+		g.curBlock.sub[g.curBlockPos+1] = b
+	}
+	g.curBlockPos++
+}
+
+func (g *Generator) resetContext(pi int) {
+	g.curPackage = pi
+	p := g.packages[pi]
+	g.curBlock = p.top
+	g.curBlockPos = len(g.curBlock.sub) - 1
+	g.curFunc = nil
+}
+
+func (g *Generator) genToplevFunction(pi int, f *Func) {
+	g.resetContext(pi)
+	g.curFunc = f
+	g.enterBlock(true)
+	g.enterBlock(true)
+	argIds := make([]string, len(f.args))
+	argStr := ""
+	for i := range f.args {
+		argIds[i] = g.newId("Param")
+		if i != 0 {
+			argStr += ", "
+		}
+		argStr += argIds[i] + " " + fmtParam(f, i)
+	}
+	recvId := ""
+	var recvTyp *Type
+	if f.recv != nil {
+		recvId = g.newId("Recv")
+		recvTyp = f.recv
+		if f.ptrRecv {
+			recvTyp = g.pointerTo(f.recv)
+		}
+		g.line("func (%v %v) %v(%v)%v {", recvId, recvTyp.id, f.name, argStr, fmtTypeList(f.rets, false))
+		g.defineVar(recvId, recvTyp)
+		if f.recv.generic != nil {
+			// The receiver declares type parameters of the generic type.
+			for _, tp := range f.recv.targs {
+				g.defineType(tp)
+			}
+		}
+		g.methodsInProgress[f.name]++
+		defer func() {
+			g.methodsInProgress[f.name]--
+		}()
+	} else if len(f.tparams) != 0 {
+		g.line("func %v[%v](%v)%v {", f.name, g.fmtTypeParams(f.tparams), argStr, fmtTypeList(f.rets, false))
+		for _, tp := range f.tparams {
+			g.defineType(tp)
+		}
+	} else {
+		g.line("func %v(%v)%v {", f.name, argStr, fmtTypeList(f.rets, false))
+	}
+	for i, a := range f.args {
+		g.defineVar(argIds[i], a)
+	}
+	if g.opts.Safe && pi == 0 && f.name == "main" {
+		g.line("defer func() { println(\"\\nchecksum:\", Checksum(), \"float:\", FloatChecksum()) }()")
+	}
+	g.curBlock.funcBoundary = true
+	g.genBlock()
+	g.leaveBlock()
+	g.stmtReturn()
+	g.line("}")
+	g.leaveBlock()
+	// Register the function only after its body is generated,
+	// so that it can't call itself recursively.
+	if f.recv != nil {
+		g.addMethod(f)
+	} else if len(f.tparams) != 0 {
+		g.packages[g.curPackage].genericFuncs = append(g.packages[g.curPackage].genericFuncs, f)
+	} else if f.name != "init" {
+		g.packages[g.curPackage].toplevFuncs = append(g.packages[g.curPackage].toplevFuncs, f)
+	}
+}
+
+// addMethod adds the method f to the method set of its receiver type.
+// Methods of generic types are added to all instantiations.
+func (g *Generator) addMethod(f *Func) {
+	f.recv.methods = append(f.recv.methods, f)
+	gt := f.recv.generic
+	if gt == nil {
+		return
+	}
+	gt.methods = append(gt.methods, f)
+	for _, t := range gt.instances {
+		if t != f.recv {
+			t.methods = append(t.methods, g.instantiateMethod(f, t))
+		}
+	}
+}
+
+// fmtParam formats type of i-th parameter in declaration of f.
+func fmtParam(f *Func, i int) string {
+	if f.variadic && i == len(f.args)-1 {
+		return "..." + f.args[i].ktyp.id
+	}
+	return f.args[i].id
+}
+
+func (g *Generator) genToplevType(pi int, t *Type) {
+	g.resetContext(pi)
+	g.enterBlock(true)
+	g.line("type %v %v", t.id, t.utyp.id)
+	g.leaveBlock()
+	g.packages[g.curPackage].toplevTypes = append(g.packages[g.curPackage].toplevTypes, t)
+}
+
+func (g *Generator) genToplevConst(pi int) {
+	g.resetContext(pi)
+	g.enterBlock(true)
+	list := g.genConstDecl()
+	g.leaveBlock()
+	g.packages[g.curPackage].toplevConsts = append(g.packages[g.curPackage].toplevConsts, list...)
+}
+
+func (g *Generator) genToplevVar(pi int, v *Var) {
+	g.resetContext(pi)
+	g.enterBlock(true)
+	g.line("var %v = %v", v.id, g.rvalue(v.typ))
+	g.leaveBlock()
+	inc(&g.features().Types, classNames[v.typ.class], 1)
+	g.packages[g.curPackage].toplevVars = append(g.packages[g.curPackage].toplevVars, v)
+}
+
+func (g *Generator) genBlock() {
+	g.enterBlock(false)
+	for g.rnd(10) != 0 {
+		g.genStatement()
+	}
+	g.leaveBlock()
+}
+
+func (g *Generator) serializeProgram() Program {
+	prog := make(Program)
+	for _, p := range g.packages {
+		if p == nil {
+			continue
+		}
+		nf := g.prof.Files
+		if g.opts.SingleFile {
+			nf = 1
+		}
+		// Imports are sorted, map order would make the output irreproducible.
+		var imports []string
+		for imp := range p.imports {
+			imports = append(imports, imp)
+		}
+		sort.Strings(imports)
+		files := make([]*bytes.Buffer, nf)
+		for i := range files {
+			w := new(bytes.Buffer)
+			files[i] = w
+			fmt.Fprintf(w, "package %s\n", p.name)
+			for _, imp := range imports {
+				fmt.Fprintf(w, "import \"%s\"\n", g.importPath(imp))
+			}
+			if i == 0 && g.opts.Safe {
+				fmt.Fprintf(w, "import \"math\"\n")
+			}
+			if i == 0 && p.name == "main" {
+				fmt.Fprintf(w, "import \"runtime\"\n")
+				fmt.Fprintf(w, "func init() {\n")
+				fmt.Fprintf(w, "	go func() {\n")
+				fmt.Fprintf(w, "		for {\n")
+				fmt.Fprintf(w, "			runtime.GC()\n")
+				fmt.Fprintf(w, "			runtime.Gosched()\n")
+				fmt.Fprintf(w, "		}\n")
+				fmt.Fprintf(w, "	}()\n")
+				fmt.Fprintf(w, "}\n")
+			}
+			for _, imp := range imports {
+				fmt.Fprintf(w, "var _ = %s.UsePackage\n", imp)
+			}
+			if i == 0 {
+				fmt.Fprintf(w, "var UsePackage = 0\n")
+				fmt.Fprintf(w, "var SINK interface{}\n")
+				if g.opts.Safe {
+					fmt.Fprintf(w, "%v", safeHelpers)
+					g.genChecksum(w, p)
+				}
+			}
+		}
+		for _, decl := range p.top.sub {
+			serializeBlock(files[g.rnd(len(files))], decl, 0)
+		}
+		for i, w := range files {
+			prog[path.Join(g.packageDir(p.name), F("%v.go", i))] = w.Bytes()
+		}
+	}
+
+	prog[path.Join(g.packageDir("a"), "0_test.go")] = []byte("package a\n")
+	if !g.opts.GOPATH {
+		prog["go.mod"] = []byte(F("module %v\n\ngo %v\n", ModulePath, GoVersion))
+	}
+	return prog
+}
+
+// packageDir returns directory of the package name in the program.
+func (g *Generator) packageDir(name string) string {
+	if g.opts.GOPATH {
+		return path.Join("src", name)
+	}
+	return name
+}
+
+// importPath returns import path of the package name.
+func (g *Generator) importPath(name string) string {
+	if g.opts.GOPATH {
+		return name
+	}
+	return ModulePath + "/" + name
+}
+
+func serializeBlock(w *bytes.Buffer, b *Block, d int) {
+	if true {
+		if b.str != "" {
+			w.WriteString(b.str)
+			w.WriteString("\n")
+		}
+	} else {
+		w.WriteString("/*" + strings.Repeat("*", d) + "*/ ")
+		w.WriteString(b.str)
+		w.WriteString(F(" // ext=%v vars=%v types=%v", b.extendable, len(b.vars), len(b.types)))
+		w.WriteString("\n")
+	}
+	for _, b1 := range b.sub {
+		serializeBlock(w, b1, d+1)
+	}
+}
+
+func (g *Generator) vars() []*Var {
+	var vars []*Var
+	vars = append(vars, g.packages[g.curPackage].toplevVars...)
+	var f func(b *Block, pos int)
+	f = func(b *Block, pos int) {
+		for _, b1 := range b.sub[:pos+1] {
+			vars = append(vars, b1.vars...)
+		}
+		if b.parent != nil {
+			pos := len(b.parent.sub) - 1
+			if b.subBlock != nil {
+				pos = -2
+				for i, b1 := range b.parent.sub {
+					if b1 == b.subBlock {
+						pos = i
+						break
+					}
+				}
+				if pos == -2 {
+					panic("bad")
+				}
+			}
+			f(b.parent, pos)
+		}
+	}
+	f(g.curBlock, g.curBlockPos)
+	return vars
+}
+
+func (g *Generator) types() []*Type {
+	var types []*Type
+	types = append(types, g.predefinedTypes...)
+	types = append(types, g.packages[g.curPackage].toplevTypes...)
+	var f func(b *Block, pos int)
+	f = func(b *Block, pos int) {
+		for _, b1 := range b.sub[:pos+1] {
+			types = append(types, b1.types...)
+		}
+		if b.parent != nil {
+			pos := len(b.parent.sub) - 1
+			if b.subBlock != nil {
+				pos = -2
+				for i, b1 := range b.parent.sub {
+					if b1 == b.subBlock {
+						pos = i
+						break
+					}
+				}
+				if pos == -2 {
+					panic("bad")
+				}
+			}
+			f(b.parent, pos)
+		}
+	}
+	f(g.curBlock, g.curBlockPos)
+	return types
+}
+
+func (g *Generator) consts() []*Const {
+	var consts []*Const
+	consts = append(consts, g.packages[g.curPackage].toplevConsts...)
+	var f func(b *Block, pos int)
+	f = func(b *Block, pos int) {
+		for _, b1 := range b.sub[:pos+1] {
+			consts = append(consts, b1.consts...)
+		}
+		if b.parent != nil {
+			pos := len(b.parent.sub) - 1
+			if b.subBlock != nil {
+				pos = -2
+				for i, b1 := range b.parent.sub {
+					if b1 == b.subBlock {
+						pos = i
+						break
+					}
+				}
+				if pos == -2 {
+					panic("bad")
+				}
+			}
+			f(b.parent, pos)
+		}
+	}
+	f(g.curBlock, g.curBlockPos)
+	return consts
+}
+
+func (g *Generator) defineVar(id string, t *Type) {
+	v := &Var{id: id, typ: t, block: g.curBlock}
+	inc(&g.features().Types, classNames[t.class], 1)
+	b := g.curBlock.sub[g.curBlockPos]
+	b.vars = append(b.vars, v)
+}
+
+func (g *Generator) defineConst(c *Const) {
+	b := g.curBlock.sub[g.curBlockPos]
+	b.consts = append(b.consts, c)
+}
+
+func (g *Generator) defineType(t *Type) {
+	b := g.curBlock.sub[g.curBlockPos]
+	b.types = append(b.types, t)
+}
+
+func (g *Generator) materializeVar(t *Type) string {
+	// TODO: generate var in another package
+	id := g.newId("Var")
+	curBlock0 := g.curBlock
+	curBlockPos0 := g.curBlockPos
+	curBlockLen0 := len(g.curBlock.sub)
+	exprDepth0 := g.exprDepth
+	exprCount0 := g.exprCount
+	g.exprDepth = 0
+	g.exprCount = 0
+	defer func() {
+		if g.curBlock == curBlock0 {
+			curBlockPos0 += len(g.curBlock.sub) - curBlockLen0
+		}
+		g.curBlock = curBlock0
+		g.curBlockPos = curBlockPos0
+		g.exprDepth = exprDepth0
+		g.exprCount = exprCount0
+	}()
+loop:
+	for {
+		if g.curBlock.parent == nil {
+			break
+		}
+		if hasTypeParam(t) {
+			// Type parameters are declared in the function signature,
+			// so the var must be declared in the function body.
+			if g.curBlock.funcBoundary {
+				break
+			}
+			if g.curBlockPos >= 0 && g.curBlock.sub[g.curBlockPos].funcBoundary {
+				// We are at the final return statement.
+				g.curBlock = g.curBlock.sub[g.curBlockPos]
+				g.curBlockPos = len(g.curBlock.sub) - 1
+				break
+			}
+		}
+		if !g.curBlock.extendable || g.curBlockPos < 0 {
+			if g.curBlock.subBlock == nil {
+				g.curBlockPos = len(g.curBlock.parent.sub) - 2
+			} else {
+				g.curBlockPos = -2
+				for i, b1 := range g.curBlock.parent.sub {
+					if b1 == g.curBlock.subBlock {
+						g.curBlockPos = i
+						break
+					}
+				}
+				if g.curBlockPos == -2 {
+					panic("bad")
+				}
+			}
+			g.curBlock = g.curBlock.parent
+			continue
+		}
+		if g.rnd(3) == 0 {
+			break
+		}
+		if g.curBlockPos >= 0 {
+			b := g.curBlock.sub[g.curBlockPos]
+			for _, t1 := range b.types {
+				if dependsOn(t, t1) {
+					break loop
+				}
+			}
+		}
+		g.curBlockPos--
+	}
+	if g.curBlock.parent == nil {
+		for i := g.curPackage; i < len(g.packages); i++ {
+			if g.rndBool() || i == len(g.packages)-1 || g.opts.SinglePkg || dependsOn(t, nil) {
+				if i == g.curPackage {
+					// emit global var into the current package
+					g.enterBlock(true)
+					g.line("var %v = %v", id, g.rvalue(t))
+					inc(&g.features().Types, classNames[t.class], 1)
+					g.packages[g.curPackage].toplevVars = append(g.packages[g.curPackage].toplevVars, &Var{id: id, typ: t})
+					g.leaveBlock()
+				} else {
+					// emit global var into another package
+					g.packages[i].undefVars = append(g.packages[i].undefVars, &Var{id: id, typ: t})
+					g.packages[g.curPackage].imports[g.packages[i].name] = true
+					g.features().CrossRefs++
+					id = g.packages[i].name + "." + id
+				}
+				break
+			}
+		}
+	} else {
+		// emit local var
+		g.line("%v := %v", id, g.rvalue(t))
+		g.defineVar(id, t)
+	}
+	return id
+}
+
+func (g *Generator) materializeFunc(rets []*Type) *Func {
+	f := &Func{name: g.newId("Func"), args: g.atypeList(TraitGlobal), rets: rets}
+	if g.rnd(4) == 0 {
+		f.args[len(f.args)-1] = g.sliceOf(f.args[len(f.args)-1])
+		f.variadic = true
+	}
+
+	curBlock0 := g.curBlock
+	curBlockPos0 := g.curBlockPos
+	curFunc0 := g.curFunc
+	exprDepth0 := g.exprDepth
+	exprCount0 := g.exprCount
+	g.exprDepth = 0
+	g.exprCount = 0
+	defer func() {
+		g.curBlock = curBlock0
+		g.curBlockPos = curBlockPos0
+		g.curFunc = curFunc0
+		g.exprDepth = exprDepth0
+		g.exprCount = exprCount0
+	}()
+
+	if g.rndBool() && !g.opts.SinglePkg && g.curPackage != len(g.packages)-1 {
+		for _, r1 := range rets {
+			if dependsOn(r1, nil) {
+				goto thisPackage
+			}
+		}
+		for _, t := range f.args {
+			if dependsOn(t, nil) {
+				goto thisPackage
+			}
+		}
+		// emit global var into another package
+		newF := new(Func)
+		*newF = *f
+		g.packages[g.curPackage+1].undefFuncs = append(g.packages[g.curPackage+1].undefFuncs, newF)
+		g.packages[g.curPackage].imports[g.packages[g.curPackage+1].name] = true
+		g.features().CrossRefs++
+		f.name = g.packages[g.curPackage+1].name + "." + f.name
+		return f
+	}
+thisPackage:
+	g.genToplevFunction(g.curPackage, f)
+	return f
+}
+
+// materializeMethod declares a new method with the given name and signature
+// on recv, or on a random package-level named type of the current
+// package if recv is nil. An empty name means a new unique name.
+func (g *Generator) materializeMethod(recv *Type, name string, args, rets []*Type) *Func {
+	for _, t := range args {
+		if dependsOn(t, nil) && !isRecvTypeParam(recv, t) {
+			return nil
+		}
+	}
+	for _, t := range rets {
+		if dependsOn(t, nil) && !isRecvTypeParam(recv, t) {
+			return nil
+		}
+	}
+	if recv == nil {
+		var cand []*Type
+		for _, t := range g.packages[g.curPackage].toplevTypes {
+			if t.class != ClassPointer && t.class != ClassInterface && t.generic == nil {
+				cand = append(cand, t)
+			}
+		}
+		if len(cand) == 0 {
+			return nil
+		}
+		recv = cand[g.rnd(len(cand))]
+	}
+	if name == "" {
+		name = g.newId("Method")
+	}
+	f := &Func{name: name, args: args, rets: rets, recv: recv, ptrRecv: g.rndBool()}
+	defer g.saveContext()()
+	g.genToplevFunction(g.curPackage, f)
+	return f
+}
+
+// isRecvTypeParam says whether t is a type parameter of the generic receiver type recv.
+func isRecvTypeParam(recv, t *Type) bool {
+	if recv == nil || recv.generic == nil {
+		return false
+	}
+	for _, tp := range recv.targs {
+		if t == tp {
+			return true
+		}
+	}
+	return false
+}
+
+// genMethods declares a random set of methods on the package-level type t.
+// Some of them repeat name and signature of methods of other types,
+// so that interfaces can have several implementations.
+func (g *Generator) genMethods(t *Type) {
+	for g.rnd(3) != 0 {
+		switch g.choice("new", "shared", "error") {
+		case "new":
+			g.materializeMethod(t, "", g.atypeList(TraitGlobal), g.atypeList(TraitGlobal))
+		case "shared":
+			var cand []*Func
+			for _, t1 := range g.packages[g.curPackage].toplevTypes {
+				for _, m := range t1.methods {
+					if !g.dispatchedMethods[m.name] && !hasMethodName(t, m.name) {
+						cand = append(cand, m)
+					}
+				}
+			}
+			if len(cand) != 0 {
+				m := cand[g.rnd(len(cand))]
+				g.materializeMethod(t, m.name, m.args, m.rets)
+			}
+		case "error":
+			if !g.dispatchedMethods["Error"] && !hasMethodName(t, "Error") {
+				g.materializeMethod(t, "Error", nil, []*Type{g.stringType})
+			}
+		default:
+			panic("bad")
+		}
+	}
+}
+
+func hasMethodName(t *Type, name string) bool {
+	for _, m := range t.methods {
+		if m.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// saveContext saves the current generation position and returns
+// a function that restores it. Blocks inserted into the current block
+// in the meantime are accounted for.
+func (g *Generator) saveContext() func() {
+	curPackage0 := g.curPackage
+	curBlock0 := g.curBlock
+	curBlockPos0 := g.curBlockPos
+	curBlockLen0 := len(g.curBlock.sub)
+	curFunc0 := g.curFunc
+	exprDepth0 := g.exprDepth
+	exprCount0 := g.exprCount
+	g.exprDepth = 0
+	g.exprCount = 0
+	return func() {
+		if g.curBlock == curBlock0 {
+			curBlockPos0 += len(g.curBlock.sub) - curBlockLen0
+		}
+		g.curPackage = curPackage0
+		g.curBlock = curBlock0
+		g.curBlockPos = curBlockPos0
+		g.curFunc = curFunc0
+		g.exprDepth = exprDepth0
+		g.exprCount = exprCount0
+	}
+}
+
+// materializeGotoLabel places a new label before the current position.
+// In the safe mode it also returns a counter that bounds the number of jumps.
+func (g *Generator) materializeGotoLabel() (string, string) {
+	// TODO: move lavel up
+	id := g.newId("Label")
+
+	curBlock0 := g.curBlock
+	curBlockPos0 := g.curBlockPos
+	curBlockLen0 := len(g.curBlock.sub)
+	defer func() {
+		if g.curBlock == curBlock0 {
+			curBlockPos0 += len(g.curBlock.sub) - curBlockLen0
+		}
+		g.curBlock = curBlock0
+		g.curBlockPos = curBlockPos0
+	}()
+
+	for {
+		if g.curBlock.parent.funcBoundary && g.curBlockPos <= 0 {
+			break
+		}
+		if !g.curBlock.extendable || g.curBlockPos < 0 {
+			if g.curBlock.subBlock != nil {
+				// we should have been stopped at func boundary
+				panic("bad")
+			}
+			g.curBlock = g.curBlock.parent
+			g.curBlockPos = len(g.curBlock.sub) - 2
+			continue
+		}
+		if g.rnd(3) == 0 {
+			break
+		}
+		g.curBlockPos--
+	}
+
+	cnt := ""
+	if g.opts.Safe {
+		cnt = g.newId("Var")
+		g.line("%v := 0", cnt)
+	}
+	g.line("%v:", id)
+	return id, cnt
+}
+
+func (g *Generator) rnd(n int) int {
+	return g.rand.Intn(n)
+}
+
+func (g *Generator) rndBool() bool {
+	return g.rnd(2) == 0
+}
+
+func (g *Generator) choice(ch ...string) string {
+	return ch[g.rnd(len(ch))]
+}
+
+func (g *Generator) newId(prefix string) string {
+	if prefix[0] < 'A' || prefix[0] > 'Z' {
+		panic("unexported id")
+	}
+	g.idSeq++
+	return fmt.Sprintf("%v%v", prefix, g.idSeq)
+}
+
+func (g *Generator) enterBlock(nonextendable bool) {
+	b := &Block{parent: g.curBlock, extendable: !nonextendable}
+	b.isBreakable = g.curBlock.isBreakable
+	b.isContinuable = g.curBlock.isContinuable
+	g.curBlock.sub = append(g.curBlock.sub, b)
+	g.curBlock = b
+	g.curBlockPos = -1
+	depth := 0
+	for ; b.parent != nil; b = b.parent {
+		depth++
+	}
+	if f := g.features(); f.MaxBlockDepth < depth {
+		f.MaxBlockDepth = depth
+	}
+}
+
+func (g *Generator) leaveBlock() {
+	for _, b := range g.curBlock.sub {
+		for _, v := range b.vars {
+			if g.opts.Safe {
+				// Fold the final value into the checksum.
+				g.line("HashState = HashMix(HashState, %v)", g.hashExpr(v.typ, v.id, 0))
+			} else if !v.used {
+				g.line("_ = %v", v.id)
+			}
+		}
+	}
+
+	g.curBlock = g.curBlock.parent
+	g.curBlockPos = len(g.curBlock.sub) - 1
+}
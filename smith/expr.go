@@ -0,0 +1,1007 @@
+package smith
+
+import (
+	"bytes"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"strings"
+)
+
+// exprKind is a kind of expression, profiles refer to it by name.
+// gen returns an empty string if the expression is not possible for the type.
+type exprKind struct {
+	name string
+	gen  func(g *Generator, res *Type) string
+}
+
+// expressionKinds returns all kinds of expressions.
+func expressionKinds() []exprKind {
+	return []exprKind{
+		{"literal", func(g *Generator, res *Type) string { return exprLiteral(res) }},
+		{"const", (*Generator).exprConst},
+		{"var", (*Generator).exprVar},
+		{"func", (*Generator).exprFunc},
+		{"field", (*Generator).exprSelectorField},
+		{"recv", (*Generator).exprRecv},
+		{"arith", (*Generator).exprArith},
+		{"equal", (*Generator).exprEqual},
+		{"order", (*Generator).exprOrder},
+		{"logical", (*Generator).exprLogical},
+		{"call", (*Generator).exprCall},
+		{"genericcall", (*Generator).exprGenericCall},
+		{"builtin", (*Generator).exprCallBuiltin},
+		{"methodcall", (*Generator).exprMethodCall},
+		{"methodvalue", (*Generator).exprMethodValue},
+		{"ifacecall", (*Generator).exprIfaceCall},
+		{"typeassert", (*Generator).exprTypeAssert},
+		{"address", (*Generator).exprAddress},
+		{"deref", (*Generator).exprDeref},
+		{"slice", (*Generator).exprSlice},
+		{"indexslice", (*Generator).exprIndexSlice},
+		{"indexarray", (*Generator).exprIndexArray},
+		{"indexstring", (*Generator).exprIndexString},
+		{"indexmap", (*Generator).exprIndexMap},
+		{"conversion", (*Generator).exprConversion},
+	}
+}
+
+// ExpressionNames returns names of all expressions in the order of generation.
+func ExpressionNames() []string {
+	var names []string
+	for _, e := range expressionKinds() {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+func (g *Generator) initExpressions() {
+	g.expressions = expressionKinds()
+	g.exprWeights = weights(g.prof.Expressions, ExpressionNames())
+}
+
+func (g *Generator) expression(res *Type) string {
+	g.exprCount++
+	g.totalExprCount++
+	if g.exprDepth >= g.prof.ExprDepth || g.exprCount >= g.prof.ExprCount || g.totalExprCount >= g.prof.TotalExprCount {
+		inc(&g.features().Expressions, "literal", 1)
+		return res.literal()
+	}
+	for {
+		g.exprDepth++
+		if f := g.features(); f.MaxExprDepth < g.exprDepth {
+			f.MaxExprDepth = g.exprDepth
+		}
+		e := g.expressions[g.weighted(g.exprWeights)]
+		s := e.gen(g, res)
+		g.exprDepth--
+		if s != "" {
+			inc(&g.features().Expressions, e.name, 1)
+			return s
+		}
+	}
+}
+
+func (g *Generator) rvalue(t *Type) string {
+	return g.expression(t)
+}
+
+// rvalue, but not a const
+// used to index arrays and strings
+func (g *Generator) nonconstRvalue(t *Type) string {
+	if t.class != ClassNumeric {
+		panic("bad")
+	}
+trying:
+	for {
+		res := ""
+		switch g.choice("lvalue", "call", "len", "selector", "recv", "arith", "indexMap", "conv") {
+		case "lvalue":
+			res = g.lvalue(t)
+		case "call":
+			res = g.exprCall(t)
+		case "len":
+			tt := g.atype(TraitLenCapable)
+			fn := g.choice("len", "cap")
+			if (tt.class == ClassString || tt.class == ClassMap) && fn == "cap" {
+				break
+			}
+			if g.opts.Safe && tt.class == ClassSlice && fn == "cap" {
+				// Capacity of appended slices depends on the implementation.
+				break
+			}
+			if tt.class == ClassArray {
+				// len/cap are const
+				break
+			}
+			res = F("(%v)((%v)(%v))", t.id, fn, g.lvalue(tt))
+		case "selector":
+			res = g.exprSelectorField(t)
+		case "recv":
+			res = g.exprRecv(t)
+		case "arith":
+			res = g.safeWord(t, F("(%v) %v (%v)", g.lvalue(t), g.choice("+", "-"), g.rvalue(t)))
+		case "indexMap":
+			res = g.exprIndexMap(t)
+		case "conv":
+			tt := g.atype(ClassNumeric)
+			if !g.safeConversion(tt, t) {
+				break
+			}
+			res = g.safeWord(t, F("(%v)(%v %v)", t.id, g.lvalue(tt), g.choice("", ",")))
+		default:
+			panic("bad")
+		}
+		if res == "" {
+			continue trying
+		}
+		return res
+	}
+}
+
+func (g *Generator) lvalue(t *Type) string {
+	for {
+		switch g.choice("var", "indexSlice", "indexArray", "selector", "deref") {
+		case "var":
+			return g.exprVar(t)
+		case "indexSlice":
+			return g.exprIndexSlice(t)
+		case "indexArray":
+			at := g.arrayOf(t)
+			if g.opts.Safe {
+				if at.size == 0 {
+					continue
+				}
+				return F("(%v)[SafeMod(%v, %v)]", g.lvalue(at), g.nonconstRvalue(g.intType), at.size)
+			}
+			return F("(%v)[%v]", g.lvalue(at), g.nonconstRvalue(g.intType))
+		case "selector":
+			for i := 0; i < 10; i++ {
+				st := g.atype(ClassStruct)
+				for _, e := range st.elems {
+					if e.typ == t {
+						return F("(%v).%v", g.lvalue(st), e.id)
+					}
+				}
+			}
+			continue
+		case "deref":
+			return g.exprDeref(t)
+		default:
+			panic("bad")
+		}
+	}
+}
+
+func (g *Generator) lvalueOrBlank(t *Type) string {
+	for {
+		switch g.choice("lvalue", "map", "blank") {
+		case "lvalue":
+			return g.lvalue(t)
+		case "map":
+			if e := g.exprIndexMap(t); e != "" {
+				return e
+			}
+		case "blank":
+			return "_"
+		default:
+			panic("bad")
+		}
+	}
+}
+
+func (g *Generator) lvalueOrMapIndex(t *Type) string {
+	for {
+		switch g.choice("lvalue", "map") {
+		case "lvalue":
+			return g.lvalue(t)
+		case "map":
+			if e := g.exprIndexMap(t); e != "" {
+				return e
+			}
+		default:
+			panic("bad")
+		}
+	}
+}
+
+func (g *Generator) fmtRvalueList(list []*Type) string {
+	var buf bytes.Buffer
+	for i, t := range list {
+		if i != 0 {
+			buf.Write([]byte{','})
+		}
+		fmt.Fprintf(&buf, "%v", g.rvalue(t))
+	}
+	return buf.String()
+}
+
+// fmtArgList formats arguments of a call of a function with parameters args.
+// The final []T parameter of a variadic function receives
+// zero, one or several arguments of type T, or a slice followed by "...".
+func (g *Generator) fmtArgList(args []*Type, variadic bool) string {
+	if !variadic {
+		return g.fmtRvalueList(args)
+	}
+	last := args[len(args)-1]
+	list := []string{}
+	if s := g.fmtRvalueList(args[:len(args)-1]); s != "" {
+		list = append(list, s)
+	}
+	switch g.choice("none", "one", "many", "spread") {
+	case "none":
+	case "one":
+		list = append(list, g.rvalue(last.ktyp))
+	case "many":
+		list = append(list, g.fmtRvalueList(typeList(last.ktyp, g.rnd(3)+2)))
+	case "spread":
+		list = append(list, g.rvalue(last)+"...")
+	default:
+		panic("bad")
+	}
+	return strings.Join(list, ", ")
+}
+
+func (g *Generator) fmtLvalueList(list []*Type) string {
+	var buf bytes.Buffer
+	for i, t := range list {
+		if i != 0 {
+			buf.Write([]byte{','})
+		}
+		buf.WriteString(g.lvalueOrBlank(t))
+	}
+	return buf.String()
+}
+
+func (g *Generator) fmtOasVarList(list []*Type) (str string, newVars []*Var) {
+	allVars := g.vars()
+	var buf bytes.Buffer
+	for i, t := range list {
+		expr := "_"
+		// First, try to find an existing var in the same scope.
+		if g.rndBool() {
+			for i, v := range allVars {
+				if v.typ == t && v.block == g.curBlock {
+					allVars[i] = allVars[len(allVars)-1]
+					allVars = allVars[:len(allVars)-1]
+					expr = v.id
+					break
+				}
+			}
+		}
+		if g.rndBool() || (i == len(list)-1 && len(newVars) == 0) {
+			expr = g.newId("Var")
+			newVars = append(newVars, &Var{id: expr, typ: t})
+		}
+
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(expr)
+	}
+	return buf.String(), newVars
+}
+
+// intLiteral returns a small constant literal or a boundary value of the integer type t.
+// Boundary values are not constant, so that constant expressions can't overflow.
+func (g *Generator) intLiteral(t *Type, small func() string) string {
+	if g.rndBool() {
+		return small()
+	}
+	bits, signed := intSize(t)
+	min, max := intRange(t)
+	var v constant.Value
+	switch g.choice("min", "max", "minus one", "high bit", "code point") {
+	case "min":
+		v = min
+	case "max":
+		v = max
+	case "minus one":
+		if !signed {
+			return small()
+		}
+		v = constant.MakeInt64(-1)
+	case "high bit":
+		if signed {
+			return small()
+		}
+		v = constant.Shift(constant.MakeInt64(1), token.SHL, bits-1)
+	case "code point":
+		if unalias(t.id) != "int32" {
+			return small()
+		}
+		v = constant.MakeInt64(int64(g.codePoint()))
+	default:
+		panic("bad")
+	}
+	return F("([]%v{%v})[0]", t.id, g.fmtInt(v, true))
+}
+
+func exprLiteral(res *Type) string {
+	if res.complexLiteral != nil {
+		return res.complexLiteral()
+	}
+	return res.literal()
+}
+
+func (g *Generator) exprConst(res *Type) string {
+	b := g.basicType(res)
+	if b == nil || b.class == ClassComplex {
+		return ""
+	}
+	s, v, typed := g.constExpr(res, true, 0)
+	if b.class == ClassNumeric {
+		// Adjust the value to a small non-negative integer, so that
+		// the constant can't overflow in any enclosing expression.
+		small := constant.ToInt(v)
+		if small.Kind() != constant.Int || constant.Sign(small) < 0 ||
+			constant.Compare(small, token.GTR, constant.MakeInt64(7)) || g.rndBool() {
+			s = F("(%v) - (%v) + %v", s, g.fmtConst(v), g.rnd(8))
+		}
+	}
+	if !typed {
+		s = F("%v(%v)", res.id, s)
+	}
+	return s
+}
+
+func (g *Generator) exprVar(res *Type) string {
+	for _, v := range g.vars() {
+		if v.typ == res {
+			return v.id
+		}
+	}
+	return g.materializeVar(res)
+}
+
+func (g *Generator) exprSelectorField(res *Type) string {
+	for i := 0; i < 10; i++ {
+		st := g.atype(ClassStruct)
+		for _, e := range st.elems {
+			if e.typ == res {
+				return F("(%v).%v", g.rvalue(st), e.id)
+			}
+		}
+	}
+	return ""
+}
+
+func (g *Generator) exprFunc(res *Type) string {
+	if !g.satisfiesTrait(res, TraitGlobal) {
+		return ""
+	}
+	var f *Func
+	for _, f1 := range g.packages[g.curPackage].toplevFuncs {
+		if len(f1.rets) == 1 && f1.rets[0] == res {
+			f = f1
+			break
+		}
+	}
+	if f == nil {
+		f = g.materializeFunc([]*Type{res})
+	}
+	if g.rndBool() || f.variadic {
+		// Results of a call can't be passed as separate arguments of ...T.
+		return F("%v(%v)", f.name, g.fmtArgList(f.args, f.variadic))
+	} else {
+		var f0 *Func
+	loop:
+		for _, f1 := range g.packages[g.curPackage].toplevFuncs {
+			if len(f1.rets) == len(f.args) {
+				for i := range f.args {
+					// TODO: check assignability
+					if f1.rets[i] != f.args[i] {
+						continue loop
+					}
+				}
+				f0 = f1
+				break
+			}
+		}
+		if f0 == nil {
+			f0 = g.materializeFunc(f.args)
+		}
+		return F("%v(%v(%v))", f.name, f0.name, g.fmtArgList(f0.args, f0.variadic))
+	}
+}
+
+func (g *Generator) exprMethodCall(res *Type) string {
+	var cand []*Func
+	for _, t := range g.types() {
+		for _, m := range t.methods {
+			if len(m.rets) == 1 && m.rets[0] == res {
+				cand = append(cand, m)
+			}
+		}
+	}
+	var m *Func
+	if len(cand) != 0 && g.rnd(3) != 0 {
+		m = cand[g.rnd(len(cand))]
+	} else {
+		m = g.materializeMethod(nil, "", g.atypeList(TraitGlobal), []*Type{res})
+		if m == nil {
+			return ""
+		}
+	}
+	switch g.choice("call", "value", "expr") {
+	case "call":
+		return F("(%v).%v(%v)", g.methodReceiver(m), m.name, g.fmtRvalueList(m.args))
+	case "value":
+		return F("((%v).%v)(%v)", g.methodReceiver(m), m.name, g.fmtRvalueList(m.args))
+	case "expr":
+		if !m.ptrRecv && g.rndBool() {
+			return F("%v.%v(%v, %v)", m.recv.id, m.name, g.rvalue(m.recv), g.fmtRvalueList(m.args))
+		}
+		pt := g.pointerTo(m.recv)
+		return F("(%v).%v(%v, %v)", pt.id, m.name, g.safePtr(pt, g.rvalue(pt)), g.fmtRvalueList(m.args))
+	default:
+		panic("bad")
+	}
+}
+
+// exprMethodValue returns a method value or a method expression of type res.
+func (g *Generator) exprMethodValue(res *Type) string {
+	if res.class != ClassFunction || res.variadic {
+		return ""
+	}
+	v := g.methodValue(res)
+	if v != "" && res.namedUserType {
+		// Method values have unnamed function types.
+		return F("%v(%v)", res.id, v)
+	}
+	return v
+}
+
+func (g *Generator) methodValue(res *Type) string {
+	for _, t := range g.types() {
+		for _, m := range t.methods {
+			if sameTypeList(m.args, res.styp) && sameTypeList(m.rets, res.rtyp) {
+				return F("(%v).%v", g.methodReceiver(m), m.name)
+			}
+			if len(res.styp) == 0 || !sameTypeList(m.args, res.styp[1:]) || !sameTypeList(m.rets, res.rtyp) {
+				continue
+			}
+			if !m.ptrRecv && res.styp[0].id == m.recv.id {
+				return F("%v.%v", m.recv.id, m.name)
+			}
+			if res.styp[0].id == "*"+m.recv.id {
+				return F("(*%v).%v", m.recv.id, m.name)
+			}
+		}
+	}
+	for _, it := range g.types() {
+		if it.class != ClassInterface || g.opts.Safe {
+			continue
+		}
+		for _, e := range it.elems {
+			if e.typ.id == res.id && g.methodsInProgress[e.id] == 0 {
+				g.dispatchedMethods[e.id] = true
+				return F("(%v).%v", g.rvalue(it), e.id)
+			}
+		}
+	}
+	m := g.materializeMethod(nil, "", res.styp, res.rtyp)
+	if m == nil {
+		return ""
+	}
+	return F("(%v).%v", g.methodReceiver(m), m.name)
+}
+
+// exprIfaceCall calls a method through an interface.
+func (g *Generator) exprIfaceCall(res *Type) string {
+	var ifaces []*Type
+	var methods []*Var
+	for _, it := range g.types() {
+		elems := it.elems
+		if it.class == ClassTypeParam {
+			// Methods of the constraint.
+			elems = it.constraint.elems
+		} else if it.class != ClassInterface {
+			continue
+		}
+		for _, e := range elems {
+			if len(e.typ.rtyp) == 1 && e.typ.rtyp[0].id == res.id && g.methodsInProgress[e.id] == 0 {
+				ifaces = append(ifaces, it)
+				methods = append(methods, e)
+			}
+		}
+	}
+	if len(methods) == 0 {
+		return ""
+	}
+	i := g.rnd(len(methods))
+	it, m := ifaces[i], methods[i]
+	g.dispatchedMethods[m.id] = true
+	if it.class == ClassInterface && (g.opts.Safe || g.rndBool()) {
+		// Convert an implementation to the interface in place.
+		// In the safe mode this is the only way to get a non-nil interface.
+		if t := g.implementation(it); t != nil {
+			x := g.rvalue(t)
+			if t.class == ClassPointer {
+				x = g.safePtr(t, x)
+			}
+			return F("((%v)(%v)).%v(%v)", it.id, x, m.id, g.fmtRvalueList(m.typ.styp))
+		}
+		if g.opts.Safe {
+			return ""
+		}
+	}
+	if g.rndBool() {
+		return F("((%v).%v)(%v)", g.rvalue(it), m.id, g.fmtRvalueList(m.typ.styp))
+	}
+	return F("(%v).%v(%v)", g.rvalue(it), m.id, g.fmtRvalueList(m.typ.styp))
+}
+
+func (g *Generator) exprTypeAssert(res *Type) string {
+	if g.opts.Safe {
+		v := g.newId("Var")
+		return F("(func() %v { if %v, ok := (%v).(%v); ok { return %v }; return %v })()",
+			res.id, v, g.rvalue(g.ifaceOf(res)), res.id, v, res.literal())
+	}
+	return F("(%v).(%v)", g.rvalue(g.ifaceOf(res)), res.id)
+}
+
+// methodReceiver returns an expression that m can be called on:
+// a value or a pointer for value methods, and a pointer or
+// an addressable value for pointer methods.
+func (g *Generator) methodReceiver(m *Func) string {
+	if g.rndBool() {
+		pt := g.pointerTo(m.recv)
+		return g.safePtr(pt, g.rvalue(pt))
+	}
+	if m.ptrRecv {
+		return g.lvalue(m.recv)
+	}
+	return g.rvalue(m.recv)
+}
+
+func (g *Generator) exprAddress(res *Type) string {
+	if res.class != ClassPointer {
+		return ""
+	}
+	if res.ktyp.class == ClassStruct && g.rndBool() {
+		return F("&%v", res.ktyp.complexLiteral())
+	}
+	return F("(%v)(&(%v))", res.id, g.lvalue(res.ktyp))
+}
+
+func (g *Generator) exprDeref(res *Type) string {
+	pt := g.pointerTo(res)
+	return F("(*(%v))", g.safePtr(pt, g.lvalue(pt)))
+}
+
+func (g *Generator) exprRecv(res *Type) string {
+	t := g.chanOf(res)
+	if g.opts.Safe {
+		return F("SafeRecv[%v](%v)", res.id, g.rvalue(t))
+	}
+	return F("(<- %v)", g.rvalue(t))
+}
+
+// exprArith returns a unary or binary arithmetic expression of type res.
+// Except for "+", the first operand is not constant, so that constant expressions
+// can't overflow or produce a negative index (int(real(1i * 1i))).
+func (g *Generator) exprArith(res *Type) string {
+	if res.class != ClassNumeric && res.class != ClassComplex &&
+		!(res.class == ClassTypeParam && len(res.constraint.terms) != 0) {
+		return ""
+	}
+	ops := g.arithOps(res)
+	if len(ops) > 1 {
+		// Unary operators are applicable if binary operators other than "+" are.
+		ops = append(ops, "unary -", "unary +")
+		if g.isInteger(res) {
+			ops = append(ops, "unary ^")
+		}
+	}
+	op := g.choice(ops...)
+	if op == "+" {
+		return g.safeWord(res, F("(%v) + (%v)", g.rvalue(res), g.rvalue(res)))
+	}
+	x := g.nonconstOperand(res)
+	if strings.HasPrefix(op, "unary ") {
+		return g.safeWord(res, F("%v(%v)", op[len("unary "):], x))
+	}
+	return g.safeWord(res, F("(%v) %v %v", x, op, g.arithOperand(res, op)))
+}
+
+// arithOps returns binary arithmetic operators applicable to operands of type t.
+func (g *Generator) arithOps(t *Type) []string {
+	ops := []string{"+"}
+	if g.opts.Safe && t.class == ClassTypeParam {
+		for _, term := range t.constraint.terms {
+			if g.wordSized(term) {
+				// Values can't be normalized with safeWord.
+				return ops
+			}
+		}
+	}
+	if g.isNumeric(t) {
+		ops = append(ops, "-", "*", "/")
+	}
+	if g.isInteger(t) {
+		ops = append(ops, "%", "&", "|", "^", "&^", "<<", ">>")
+	}
+	return ops
+}
+
+// arithOperand returns the second operand of the binary operator op with operands of type t.
+// Divisors are never zero and shift counts are never negative.
+func (g *Generator) arithOperand(t *Type, op string) string {
+	switch op {
+	case "/", "%":
+		switch {
+		case g.isInteger(t):
+			return F("((%v)|1)", g.rvalue(t))
+		case t.class == ClassTypeParam:
+			// x*x+1 is not zero for both integers and floats.
+			x := g.rvalue(t)
+			return F("((%v)*(%v) + 1)", x, x)
+		default:
+			// Floating-point division by zero is not a panic,
+			// but division by constant zero does not compile.
+			return F("(%v)", g.nonconstOperand(t))
+		}
+	case "<<", ">>":
+		switch g.choice("const", "unsigned", "signed") {
+		case "const":
+			return F("%v", g.rnd(70))
+		case "unsigned":
+			return F("(%v)", g.rvalue(g.predefined(g.choice("byte", "uint8", "uint16", "uint32", "uint64", "uint", "uintptr"))))
+		default:
+			return F("((%v)&%v)", g.rvalue(g.predefined(g.choice("int8", "int16", "int32", "int64", "int", "rune"))), g.choice("7", "31", "63", "127"))
+		}
+	default:
+		return F("(%v)", g.rvalue(t))
+	}
+}
+
+// nonconstOperand returns a non-constant expression of numeric, complex or type parameter type t.
+func (g *Generator) nonconstOperand(t *Type) string {
+	switch t.class {
+	case ClassNumeric:
+		return g.nonconstRvalue(t)
+	case ClassTypeParam:
+		// Values of type parameter types are never constant.
+		return g.rvalue(t)
+	default:
+		return g.lvalue(t)
+	}
+}
+
+// isNumeric says whether t is an integer, floating-point or complex type,
+// or a type parameter with only such types in the type set.
+func (g *Generator) isNumeric(t *Type) bool {
+	if t.class == ClassTypeParam {
+		for _, term := range t.constraint.terms {
+			if !g.isNumeric(term) {
+				return false
+			}
+		}
+		return len(t.constraint.terms) != 0
+	}
+	return t.class == ClassNumeric || t.class == ClassComplex
+}
+
+// isInteger says whether t is an integer type,
+// or a type parameter with only integer types in the type set.
+func (g *Generator) isInteger(t *Type) bool {
+	if t.class == ClassTypeParam {
+		for _, term := range t.constraint.terms {
+			if !g.isInteger(term) {
+				return false
+			}
+		}
+		return len(t.constraint.terms) != 0
+	}
+	b := g.basicType(t)
+	return b != nil && b.class == ClassNumeric && !g.isFloat(b)
+}
+
+func (g *Generator) exprEqual(res *Type) string {
+	if res != g.boolType {
+		return ""
+	}
+	t := g.atype(TraitComparable)
+	return F("(%v) %v (%v)", g.rvalue(t), g.choice("==", "!="), g.rvalue(t))
+}
+
+func (g *Generator) exprOrder(res *Type) string {
+	if res != g.boolType {
+		return ""
+	}
+	t := g.atype(TraitOrdered)
+	return F("(%v) %v (%v)", g.rvalue(t), g.choice("<", "<=", ">", ">="), g.rvalue(t))
+
+}
+
+// exprLogical returns a negation or a short-circuit expression. The right operand
+// of && and || mostly has side effects, so it matters whether it is evaluated.
+func (g *Generator) exprLogical(res *Type) string {
+	if res.class != ClassBoolean {
+		return ""
+	}
+	if g.rnd(3) == 0 {
+		return F("!(%v)", g.rvalue(res))
+	}
+	return F("(%v) %v (%v)", g.rvalue(res), g.choice("&&", "||"), g.sideEffect(res))
+}
+
+// sideEffect returns an expression of type res that has side effects.
+func (g *Generator) sideEffect(res *Type) string {
+	switch g.choice("call", "closure", "recv", "mapwrite", "rvalue") {
+	case "call":
+		return g.exprCall(res)
+	case "closure":
+		return F("(%v)()", g.genFuncLit(g.funcOf(nil, []*Type{res})))
+	case "recv":
+		return g.exprRecv(res)
+	case "mapwrite":
+		t := g.atype(ClassMap)
+		return F("func() %v { %v = %v; return %v }()", res.id, g.mapIndex(t), g.rvalue(t.vtyp), g.rvalue(res))
+	case "rvalue":
+	default:
+		panic("bad")
+	}
+	return g.rvalue(res)
+}
+
+func (g *Generator) exprCall(ret *Type) string {
+	args := g.atypeList(TraitAny)
+	t := g.funcOf(args, []*Type{ret})
+	if g.rnd(4) == 0 {
+		args[len(args)-1] = g.sliceOf(args[len(args)-1])
+		t = g.variadicFuncOf(args, []*Type{ret})
+	}
+	return F("%v(%v)", g.safeFunc(t, g.rvalue(t)), g.fmtArgList(t.styp, t.variadic))
+}
+
+// exprGenericCall calls a generic function, type arguments
+// are either explicit or inferred from function arguments.
+func (g *Generator) exprGenericCall(res *Type) string {
+	var cand []*Func
+	for _, f := range g.packages[g.curPackage].genericFuncs {
+		if len(f.rets) == 1 && (f.rets[0] == res || containsType(f.tparams, f.rets[0]) && g.satisfies(res, f.rets[0].constraint)) {
+			cand = append(cand, f)
+		}
+	}
+	var f *Func
+	if len(cand) != 0 && g.rnd(3) != 0 {
+		f = cand[g.rnd(len(cand))]
+	} else {
+		f = g.materializeGenericFunc(res)
+	}
+	targs := g.genericTypeArgs(f, res)
+	if targs == nil {
+		return ""
+	}
+	// Trailing type arguments can be omitted if they are inferred from arguments.
+	n := len(targs)
+	for n > 0 && containsType(f.args, f.tparams[n-1]) && g.rndBool() {
+		n--
+	}
+	args := g.fmtRvalueList(g.substList(f.args, f.tparams, targs))
+	if n == 0 {
+		return F("%v(%v)", f.name, args)
+	}
+	return F("%v[%v](%v)", f.name, fmtTypeArgs(targs[:n]), args)
+}
+
+func (g *Generator) exprCallBuiltin(ret *Type) string {
+	switch fn := g.choice("append", "cap", "complex", "copy", "imag", "len", "make", "new", "real", "recover"); fn {
+	case "append":
+		if ret.class != ClassSlice {
+			return ""
+		}
+		if g.opts.Safe {
+			// Always reallocate, so that aliasing of the result
+			// does not depend on capacity growth policy.
+			fn = F("SafeAppend[%v]", ret.id)
+		}
+		switch g.choice("one", "two", "slice") {
+		case "one":
+			return F("%v(%v, %v)", fn, g.rvalue(ret), g.rvalue(ret.ktyp))
+		case "two":
+			return F("%v(%v, %v, %v)", fn, g.rvalue(ret), g.rvalue(ret.ktyp), g.rvalue(ret.ktyp))
+		case "slice":
+			return F("%v(%v, %v...)", fn, g.rvalue(ret), g.rvalue(ret))
+		default:
+			panic("bad")
+		}
+	case "len", "cap":
+		if ret != g.intType { // TODO: must be convertable
+			return ""
+		}
+		t := g.atype(TraitLenCapable)
+		if (t.class == ClassString || t.class == ClassMap) && fn == "cap" {
+			return ""
+
+		}
+		if g.opts.Safe && t.class == ClassSlice && fn == "cap" {
+			return ""
+		}
+		return F("%v(%v)", fn, g.rvalue(t))
+	case "copy":
+		if ret != g.intType {
+			return ""
+		}
+		return F("%v", g.exprCopySlice())
+	case "make":
+		if ret.class != ClassSlice && ret.class != ClassMap && ret.class != ClassChan {
+			return ""
+		}
+		cap := ""
+		if ret.class == ClassSlice {
+			if g.rndBool() {
+				cap = F(", %v", g.safeSize())
+			} else {
+				// Careful to not generate "len larger than cap".
+				cap = F(", 0, %v", g.safeSize())
+			}
+		} else if g.rndBool() {
+			cap = F(", %v", g.safeSize())
+		}
+		return F("make(%v %v)", ret.id, cap)
+	case "new":
+		if ret.class != ClassPointer {
+			return ""
+		}
+		return F("new(%v)", ret.ktyp.id)
+	case "recover":
+		if ret != g.efaceType {
+			return ""
+		}
+		return "recover()"
+	case "real", "imag":
+		if ret == g.float32Type {
+			return F("real(%v)", g.rvalue(g.complex64Type))
+		}
+		if ret == g.float64Type {
+			return F("real(%v)", g.rvalue(g.complex128Type))
+		}
+		return ""
+	case "complex":
+		if ret == g.complex64Type {
+			return F("complex(%v, %v)", g.rvalue(g.float32Type), g.rvalue(g.float32Type))
+		}
+		if ret == g.complex128Type {
+			return F("complex(%v, %v)", g.rvalue(g.float64Type), g.rvalue(g.float64Type))
+		}
+		return ""
+	default:
+		panic("bad")
+	}
+}
+
+func (g *Generator) exprCopySlice() string {
+	if g.rndBool() {
+		t := g.atype(ClassSlice)
+		return F("copy(%v, %v)", g.rvalue(t), g.rvalue(t))
+	} else {
+		return F("copy(%v, %v)", g.rvalue(g.sliceOf(g.byteType)), g.rvalue(g.stringType))
+	}
+}
+
+func (g *Generator) exprSlice(ret *Type) string {
+	if ret.class != ClassSlice {
+		return ""
+	}
+	if g.opts.Safe {
+		s := g.rvalue(ret)
+		lo := "0"
+		if g.rndBool() {
+			lo = g.nonconstRvalue(g.intType)
+		}
+		hi := g.nonconstRvalue(g.intType)
+		if g.rndBool() {
+			return F("SafeSlice3[%v](%v, %v, %v, %v)", ret.id, s, lo, hi, g.nonconstRvalue(g.intType))
+		}
+		return F("SafeSlice[%v](%v, %v, %v)", ret.id, s, lo, hi)
+	}
+	i0 := ""
+	if g.rndBool() {
+		i0 = g.nonconstRvalue(g.intType)
+	}
+	i2 := ""
+	if g.rndBool() {
+		i2 = ":" + g.nonconstRvalue(g.intType)
+	}
+	i1 := ":"
+	if g.rndBool() || i2 != "" {
+		i1 = ":" + g.nonconstRvalue(g.intType)
+	}
+	return F("(%v)[%v%v%v]", g.rvalue(ret), i0, i1, i2)
+}
+
+func (g *Generator) exprIndexSlice(ret *Type) string {
+	t := g.sliceOf(ret)
+	if g.opts.Safe {
+		return F("(*SafeElem[%v](%v, %v))", t.id, g.rvalue(t), g.nonconstRvalue(g.intType))
+	}
+	return F("(%v)[%v]", g.rvalue(t), g.nonconstRvalue(g.intType))
+}
+
+func (g *Generator) exprIndexString(ret *Type) string {
+	if ret != g.byteType {
+		return ""
+	}
+	if g.opts.Safe {
+		return F("SafeByte(%v, %v)", g.rvalue(g.stringType), g.nonconstRvalue(g.intType))
+	}
+	return F("(%v)[%v]", g.rvalue(g.stringType), g.nonconstRvalue(g.intType))
+}
+
+func (g *Generator) exprIndexArray(ret *Type) string {
+	// TODO: also handle indexing of pointers to arrays
+	t := g.arrayOf(ret)
+	if g.opts.Safe {
+		if t.size == 0 {
+			return ""
+		}
+		return F("(%v)[SafeMod(%v, %v)]", g.rvalue(t), g.nonconstRvalue(g.intType), t.size)
+	}
+	return F("(%v)[%v]", g.rvalue(t), g.nonconstRvalue(g.intType))
+}
+
+func (g *Generator) exprIndexMap(ret *Type) string {
+	// TODO: figure out something better
+	for i := 0; i < 10; i++ {
+		t := g.atype(ClassMap)
+		if t.vtyp == ret {
+			return g.mapIndex(t)
+		}
+	}
+	return ""
+}
+
+// mapIndex returns an index expression of a map of type t.
+func (g *Generator) mapIndex(t *Type) string {
+	if g.opts.Safe {
+		// The map can be assigned to.
+		return F("(SafeMap[%v](%v))[%v]", t.id, g.rvalue(t), g.rvalue(t.ktyp))
+	}
+	return F("(%v)[%v]", g.rvalue(t), g.rvalue(t.ktyp))
+}
+
+func (g *Generator) exprConversion(ret *Type) string {
+	if ret.class == ClassNumeric {
+		t := g.atype(ClassNumeric)
+		if !g.safeConversion(t, ret) {
+			return ""
+		}
+		return g.safeWord(ret, F("(%v)(%v %v)", ret.id, g.rvalue(t), g.choice("", ",")))
+	}
+	if ret.class == ClassComplex {
+		return F("(%v)(%v %v)", ret.id, g.rvalue(g.atype(ClassComplex)), g.choice("", ","))
+	}
+	if ret == g.stringType {
+		switch g.choice("int", "byteSlice", "runeSlice") {
+		case "int":
+			// We produce a string of length at least 3, to not produce
+			// "invalid string index 1 (out of bounds for 1-byte string)"
+			return F("(%v)((%v) + (1<<24) %v)", ret.id, g.rvalue(g.intType), g.choice("", ","))
+		case "byteSlice":
+			return F("(%v)(%v %v)", ret.id, g.rvalue(g.sliceOf(g.byteType)), g.choice("", ","))
+		case "runeSlice":
+			return F("(%v)(%v %v)", ret.id, g.rvalue(g.sliceOf(g.runeType)), g.choice("", ","))
+		default:
+			panic("bad")
+		}
+	}
+	if ret.class == ClassSlice && (ret.ktyp == g.byteType || ret.ktyp == g.runeType) {
+		return F("(%v)(%v %v)", ret.id, g.rvalue(g.stringType), g.choice("", ","))
+	}
+	if ret.class == ClassInterface {
+		if t := g.implementation(ret); t != nil {
+			x := g.rvalue(t)
+			if t.class == ClassPointer {
+				x = g.safePtr(t, x)
+			}
+			return F("(%v)(%v %v)", ret.id, x, g.choice("", ","))
+		}
+	}
+	// TODO: handle "x is assignable to T"
+	// TODO: handle "x's type and T have identical underlying types"
+	// TODO: handle "x's type and T are unnamed pointer types and their pointer base types have identical underlying types"
+	return ""
+}
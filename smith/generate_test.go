@@ -0,0 +1,55 @@
+package smith
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+)
+
+// TestDeterminism checks that the same seed and options generate the same program,
+// the driver and reduce rely on seeds to reproduce programs.
+func TestDeterminism(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"safe", Options{Safe: true}},
+		{"swarm", Options{Swarm: true}},
+		{"gopath", Options{GOPATH: true}},
+	}
+	seeds := int64(300)
+	if testing.Short() {
+		seeds = 30
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			for seed := int64(1); seed <= seeds; seed++ {
+				prog1 := NewGenerator(seed, test.opts).Generate()
+				prog2 := NewGenerator(seed, test.opts).Generate()
+				if diff := diffPrograms(prog1, prog2); len(diff) != 0 {
+					t.Errorf("seed %v: nondeterministic files: %v", seed, diff)
+				}
+			}
+		})
+	}
+}
+
+// diffPrograms returns sorted names of files that differ between the programs.
+func diffPrograms(prog1, prog2 Program) []string {
+	var diff []string
+	for name, data := range prog1 {
+		if data2, ok := prog2[name]; !ok || !bytes.Equal(data, data2) {
+			diff = append(diff, name)
+		}
+	}
+	for name := range prog2 {
+		if _, ok := prog1[name]; !ok {
+			diff = append(diff, name)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
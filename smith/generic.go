@@ -0,0 +1,579 @@
+package smith
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Type parameters are local named types of class ClassTypeParam.
+// Generic types and functions are declared at package level only,
+// so constraints and fixed parts of signatures use predeclared types.
+
+func (g *Generator) typeParam(c *Type) *Type {
+	id := g.newId("Tp")
+	return &Type{
+		id:            id,
+		class:         ClassTypeParam,
+		namedUserType: true,
+		constraint:    c,
+		literal: func() string {
+			return F("*new(%v)", id)
+		},
+	}
+}
+
+// typeParamTrait says whether all types in the type set of the type parameter t satisfy trait.
+func (g *Generator) typeParamTrait(t *Type, trait TypeClass) bool {
+	c := t.constraint
+	switch trait {
+	case TraitAny:
+		return true
+	case TraitOrdered:
+		return len(c.terms) != 0
+	case TraitComparable, TraitHashable:
+		return c == g.comparableConstraint || len(c.terms) != 0
+	default:
+		return false
+	}
+}
+
+func (g *Generator) fmtTypeParams(tparams []*Type) string {
+	var buf bytes.Buffer
+	for i, tp := range tparams {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		c := tp.constraint
+		if len(c.terms) != 0 && !c.namedUserType && g.rndBool() {
+			// Type sets can be written without the enclosing interface.
+			fmt.Fprintf(&buf, "%v %v", tp.id, fmtUnion(c))
+		} else {
+			fmt.Fprintf(&buf, "%v %v", tp.id, c.id)
+		}
+	}
+	return buf.String()
+}
+
+func fmtTypeArgs(targs []*Type) string {
+	var buf bytes.Buffer
+	for i, t := range targs {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(t.id)
+	}
+	return buf.String()
+}
+
+func fmtUnion(c *Type) string {
+	var buf bytes.Buffer
+	for i, t := range c.terms {
+		if i != 0 {
+			buf.WriteString(" | ")
+		}
+		if c.tilde {
+			buf.WriteString("~")
+		}
+		buf.WriteString(t.id)
+	}
+	return buf.String()
+}
+
+// genConstraint returns a random constraint.
+// Named constraints are declared in the current package,
+// so they can't be used if inline is set.
+func (g *Generator) genConstraint(inline bool) *Type {
+	p := g.packages[g.curPackage]
+	if !inline && len(p.constraints) != 0 && g.rnd(3) == 0 {
+		return p.constraints[g.rnd(len(p.constraints))]
+	}
+	var c *Type
+	switch g.choice("any", "comparable", "terms", "methods") {
+	case "any":
+		return g.anyConstraint
+	case "comparable":
+		return g.comparableConstraint
+	case "terms":
+		c = g.termsConstraint(nil, g.rndBool())
+	case "methods":
+		var cand []*Type
+		for _, t := range g.types() {
+			if len(t.methods) != 0 {
+				cand = append(cand, t)
+			}
+		}
+		if len(cand) == 0 {
+			return g.anyConstraint
+		}
+		if c = g.methodConstraint(cand[g.rnd(len(cand))]); c == nil {
+			return g.anyConstraint
+		}
+	default:
+		panic("bad")
+	}
+	if !inline && g.rnd(3) == 0 {
+		c = g.namedConstraint(c)
+	}
+	return c
+}
+
+// constraintFor returns a random constraint that t satisfies.
+func (g *Generator) constraintFor(t *Type, inline bool) *Type {
+	var c *Type
+	switch g.choice("any", "comparable", "terms", "methods") {
+	case "any":
+	case "comparable":
+		if g.satisfiesTrait(t, TraitComparable) {
+			c = g.comparableConstraint
+		}
+	case "terms":
+		if t.class == ClassTypeParam {
+			if len(t.constraint.terms) != 0 {
+				c = t.constraint
+			}
+		} else if b := g.basicType(t); b != nil && (b.class == ClassNumeric || b.class == ClassString) {
+			c = g.termsConstraint(b, t != b || g.rndBool())
+		}
+	case "methods":
+		c = g.methodConstraint(t)
+	default:
+		panic("bad")
+	}
+	if c == nil || inline && dependsOn(c, nil) || !g.satisfies(t, c) {
+		return g.anyConstraint
+	}
+	return c
+}
+
+// termsConstraint returns a constraint with a random type set of integer,
+// numeric or ordered types. The type set includes must if it is not nil.
+func (g *Generator) termsConstraint(must *Type, tilde bool) *Type {
+	kind := g.choice("int", "numeric", "ordered")
+	if must != nil && g.isFloat(must) && kind == "int" || must == g.stringType {
+		kind = "ordered"
+	}
+	var pool []*Type
+	for _, t := range g.predefinedTypes {
+		switch {
+		case must != nil && unalias(t.id) == unalias(must.id):
+		case t.class == ClassNumeric && (kind != "int" || !g.isFloat(t)):
+			pool = append(pool, t)
+		case t == g.stringType && kind == "ordered":
+			pool = append(pool, t)
+		}
+	}
+	var terms []*Type
+	if must != nil {
+		terms = append(terms, must)
+	}
+	for len(terms) == 0 || g.rndBool() && len(pool) != 0 {
+		t := pool[g.rnd(len(pool))]
+		terms = append(terms, t)
+		// Terms can't overlap, so aliases of t are removed as well.
+		var rest []*Type
+		for _, t1 := range pool {
+			if unalias(t1.id) != unalias(t.id) {
+				rest = append(rest, t1)
+			}
+		}
+		pool = rest
+	}
+	i := g.rnd(len(terms))
+	terms[0], terms[i] = terms[i], terms[0]
+	c := &Type{class: ClassInterface, terms: terms, tilde: tilde}
+	c.id = F("interface { %v }", fmtUnion(c))
+	return c
+}
+
+// methodConstraint returns a constraint with a subset of the method set of t,
+// or nil if t has no suitable methods.
+func (g *Generator) methodConstraint(t *Type) *Type {
+	var all []*Var
+	switch t.class {
+	case ClassInterface:
+		all = t.elems
+	case ClassTypeParam:
+		all = t.constraint.elems
+	default:
+		for _, m := range t.methods {
+			if !m.ptrRecv {
+				all = append(all, &Var{id: m.name, typ: g.funcOf(m.args, m.rets)})
+			}
+		}
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	var elems []*Var
+	first := g.rnd(len(all))
+	for i, e := range all {
+		if i == first || g.rndBool() {
+			elems = append(elems, e)
+		}
+	}
+	c := interfaceOf(elems)
+	if dependsOn(c, nil) {
+		return nil
+	}
+	return c
+}
+
+// namedConstraint declares the constraint c at package level.
+func (g *Generator) namedConstraint(c *Type) *Type {
+	nc := new(Type)
+	*nc = *c
+	nc.id = g.newId("Type")
+	nc.namedUserType = true
+	defer g.saveContext()()
+	g.resetContext(g.curPackage)
+	g.enterBlock(true)
+	g.line("type %v %v", nc.id, c.id)
+	g.leaveBlock()
+	g.packages[g.curPackage].constraints = append(g.packages[g.curPackage].constraints, nc)
+	return nc
+}
+
+// satisfies says whether t satisfies the constraint c.
+func (g *Generator) satisfies(t, c *Type) bool {
+	switch {
+	case c == g.anyConstraint:
+		return true
+	case c == g.comparableConstraint:
+		return g.satisfiesTrait(t, TraitComparable)
+	case len(c.terms) != 0:
+		if t.class == ClassTypeParam {
+			tc := t.constraint
+			if len(tc.terms) == 0 || tc.tilde && !c.tilde {
+				return false
+			}
+			for _, t1 := range tc.terms {
+				if !containsType(c.terms, t1) {
+					return false
+				}
+			}
+			return true
+		}
+		if c.tilde {
+			t = g.basicType(t)
+		}
+		return t != nil && containsType(c.terms, t)
+	default:
+		if g.opts.Safe && (t.class == ClassInterface || t.class == ClassPointer) {
+			// Zero value of the type parameter would panic on a method call.
+			return false
+		}
+		return implements(t, c)
+	}
+}
+
+func containsType(list []*Type, t *Type) bool {
+	for _, t1 := range list {
+		if t1 == t {
+			return true
+		}
+	}
+	return false
+}
+
+// typeArg returns a random visible type that satisfies the constraint c,
+// or nil if there are no such types.
+func (g *Generator) typeArg(c *Type) *Type {
+	if c == g.anyConstraint {
+		return g.atype(TraitAny)
+	}
+	var cand []*Type
+	for _, t := range g.types() {
+		if g.satisfies(t, c) {
+			cand = append(cand, t)
+		}
+		if len(c.elems) != 0 && len(t.methods) != 0 {
+			if pt := g.pointerTo(t); g.satisfies(pt, c) {
+				cand = append(cand, pt)
+			}
+		}
+	}
+	if len(cand) == 0 {
+		return nil
+	}
+	return cand[g.rnd(len(cand))]
+}
+
+// hasTypeParam says whether t refers to a type parameter.
+func hasTypeParam(t *Type) bool {
+	if t == nil {
+		return false
+	}
+	if t.class == ClassTypeParam {
+		return true
+	}
+	if hasTypeParam(t.ktyp) || hasTypeParam(t.vtyp) {
+		return true
+	}
+	for _, list := range [][]*Type{t.styp, t.rtyp, t.targs} {
+		for _, t1 := range list {
+			if hasTypeParam(t1) {
+				return true
+			}
+		}
+	}
+	for _, e := range t.elems {
+		if hasTypeParam(e.typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// subst replaces type parameters tparams in t with targs.
+func (g *Generator) subst(t *Type, tparams, targs []*Type) *Type {
+	for i, tp := range tparams {
+		if t == tp {
+			return targs[i]
+		}
+	}
+	if t.namedUserType || !hasTypeParam(t) {
+		return t
+	}
+	switch t.class {
+	case ClassSlice:
+		return g.sliceOf(g.subst(t.ktyp, tparams, targs))
+	case ClassPointer:
+		return g.pointerTo(g.subst(t.ktyp, tparams, targs))
+	case ClassChan:
+		return g.chanOf(g.subst(t.ktyp, tparams, targs))
+	case ClassMap:
+		return g.mapOf(g.subst(t.ktyp, tparams, targs), g.subst(t.vtyp, tparams, targs))
+	default:
+		panic("bad")
+	}
+}
+
+func (g *Generator) substList(list, tparams, targs []*Type) []*Type {
+	res := make([]*Type, len(list))
+	for i, t := range list {
+		res[i] = g.subst(t, tparams, targs)
+	}
+	return res
+}
+
+// genericTypeList returns a random list of types that refer to tparams.
+func (g *Generator) genericTypeList(tparams []*Type, n int) []*Type {
+	list := make([]*Type, n)
+	for i := range list {
+		switch g.choice("param", "slice", "global") {
+		case "param":
+			list[i] = tparams[g.rnd(len(tparams))]
+		case "slice":
+			list[i] = g.sliceOf(tparams[g.rnd(len(tparams))])
+		case "global":
+			list[i] = g.atype(TraitGlobal)
+		default:
+			panic("bad")
+		}
+	}
+	return list
+}
+
+// genGenericType declares a generic type with methods in package pi.
+func (g *Generator) genGenericType(pi int) {
+	g.resetContext(pi)
+	tparams := make([]*Type, g.rnd(2)+1)
+	for i := range tparams {
+		tparams[i] = g.typeParam(g.genConstraint(false))
+	}
+	gt := &Type{
+		id:            g.newId("Type"),
+		namedUserType: true,
+		tparams:       tparams,
+		instances:     make(map[string]*Type),
+		underlying:    g.genGenericUnderlying(tparams),
+	}
+	g.enterBlock(true)
+	g.line("type %v[%v] %v", gt.id, g.fmtTypeParams(tparams), gt.underlying(tparams).id)
+	g.leaveBlock()
+	// Methods are declared on the instantiation with the type parameters themselves.
+	self := g.instantiate(gt, tparams)
+	for g.rnd(3) != 0 {
+		g.materializeMethod(self, "", g.genericTypeList(tparams, g.rnd(3)), g.genericTypeList(tparams, g.rnd(3)))
+	}
+	// Register the type only after its methods are generated, so that they can't
+	// instantiate it with their own type parameters (an instantiation cycle).
+	g.packages[pi].generics = append(g.packages[pi].generics, gt)
+}
+
+// genGenericUnderlying returns a function that constructs
+// the underlying type of a generic type for given type arguments.
+func (g *Generator) genGenericUnderlying(tparams []*Type) func(targs []*Type) *Type {
+	// Each component of the type is either a type parameter
+	// (identified by index) or a fixed predeclared type.
+	type component struct {
+		param int
+		fixed *Type
+	}
+	pick := func() component {
+		if g.rnd(3) == 0 {
+			return component{-1, g.atype(TraitGlobal)}
+		}
+		return component{g.rnd(len(tparams)), nil}
+	}
+	get := func(c component, targs []*Type) *Type {
+		if c.param < 0 {
+			return c.fixed
+		}
+		return targs[c.param]
+	}
+	switch g.choice("struct", "slice", "map", "chan", "func") {
+	case "struct":
+		var ids []string
+		var fields []component
+		for len(fields) == 0 || g.rndBool() {
+			ids = append(ids, g.newId("Field"))
+			fields = append(fields, pick())
+		}
+		return func(targs []*Type) *Type {
+			elems := make([]*Var, len(fields))
+			for i, f := range fields {
+				elems[i] = &Var{id: ids[i], typ: get(f, targs)}
+			}
+			return g.structOf(elems)
+		}
+	case "slice":
+		elem := pick()
+		return func(targs []*Type) *Type {
+			return g.sliceOf(get(elem, targs))
+		}
+	case "chan":
+		elem := pick()
+		return func(targs []*Type) *Type {
+			return g.chanOf(get(elem, targs))
+		}
+	case "map":
+		key := component{-1, g.atype(TraitGlobal)}
+		for i, tp := range tparams {
+			if g.typeParamTrait(tp, TraitHashable) && g.rndBool() {
+				key = component{i, nil}
+			}
+		}
+		val := pick()
+		return func(targs []*Type) *Type {
+			return g.mapOf(get(key, targs), get(val, targs))
+		}
+	case "func":
+		var args, rets []component
+		for g.rndBool() {
+			args = append(args, pick())
+		}
+		for g.rndBool() {
+			rets = append(rets, pick())
+		}
+		return func(targs []*Type) *Type {
+			alist := make([]*Type, len(args))
+			for i, a := range args {
+				alist[i] = get(a, targs)
+			}
+			rlist := make([]*Type, len(rets))
+			for i, r := range rets {
+				rlist[i] = get(r, targs)
+			}
+			return g.funcOf(alist, rlist)
+		}
+	default:
+		panic("bad")
+	}
+}
+
+// instantiate returns the instantiation of the generic type g with targs.
+func (g *Generator) instantiate(gt *Type, targs []*Type) *Type {
+	id := F("%v[%v]", gt.id, fmtTypeArgs(targs))
+	if t := gt.instances[id]; t != nil {
+		return t
+	}
+	t := namedType(id, gt.underlying(targs))
+	t.generic = gt
+	t.targs = targs
+	gt.instances[id] = t
+	for _, m := range gt.methods {
+		t.methods = append(t.methods, g.instantiateMethod(m, t))
+	}
+	for _, t1 := range targs {
+		if dependsOn(t1, nil) {
+			return t
+		}
+	}
+	// Instantiations with predeclared types can be used everywhere in the package.
+	g.packages[g.curPackage].toplevTypes = append(g.packages[g.curPackage].toplevTypes, t)
+	return t
+}
+
+// instantiateMethod returns the method m of a generic type as a method of its instantiation t.
+func (g *Generator) instantiateMethod(m *Func, t *Type) *Func {
+	tparams := m.recv.targs
+	return &Func{
+		name:    m.name,
+		args:    g.substList(m.args, tparams, t.targs),
+		rets:    g.substList(m.rets, tparams, t.targs),
+		recv:    t,
+		ptrRecv: m.ptrRecv,
+	}
+}
+
+// materializeGenericFunc declares a new generic function
+// with a single result that can be instantiated to res.
+func (g *Generator) materializeGenericFunc(res *Type) *Func {
+	defer g.saveContext()()
+	// Generic functions in other packages can't refer to named constraints.
+	other := g.rndBool() && !g.opts.SinglePkg && g.curPackage != len(g.packages)-1
+	tparams := make([]*Type, g.rnd(3)+1)
+	var rets []*Type
+	if g.satisfiesTrait(res, TraitGlobal) && g.rnd(3) == 0 {
+		rets = []*Type{res}
+	} else {
+		tparams[0] = g.typeParam(g.constraintFor(res, other))
+		rets = []*Type{tparams[0]}
+	}
+	for i := range tparams {
+		if tparams[i] == nil {
+			tparams[i] = g.typeParam(g.genConstraint(other))
+		}
+	}
+	f := &Func{name: g.newId("Func"), args: g.genericTypeList(tparams, g.rnd(3)+1), rets: rets, tparams: tparams}
+	if other {
+		newF := new(Func)
+		*newF = *f
+		g.packages[g.curPackage+1].undefFuncs = append(g.packages[g.curPackage+1].undefFuncs, newF)
+		g.packages[g.curPackage].imports[g.packages[g.curPackage+1].name] = true
+		g.features().CrossRefs++
+		f.name = g.packages[g.curPackage+1].name + "." + f.name
+		g.packages[g.curPackage].genericFuncs = append(g.packages[g.curPackage].genericFuncs, f)
+		return f
+	}
+	g.genToplevFunction(g.curPackage, f)
+	return f
+}
+
+// genericTypeArgs returns type arguments for f so that it returns res,
+// or nil if there are no suitable type arguments.
+func (g *Generator) genericTypeArgs(f *Func, res *Type) []*Type {
+	if len(f.rets) != 1 {
+		return nil
+	}
+	targs := make([]*Type, len(f.tparams))
+	if r := f.rets[0]; r != res {
+		i := 0
+		for i < len(f.tparams) && f.tparams[i] != r {
+			i++
+		}
+		if i == len(f.tparams) || !g.satisfies(res, r.constraint) {
+			return nil
+		}
+		targs[i] = res
+	}
+	for i, tp := range f.tparams {
+		if targs[i] == nil {
+			if targs[i] = g.typeArg(tp.constraint); targs[i] == nil {
+				return nil
+			}
+		}
+	}
+	return targs
+}
@@ -0,0 +1,276 @@
+package smith
+
+import (
+	"bytes"
+	"go/constant"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Numeric literals are spelled in random equivalent ways (hex, octal and binary
+// integers, digit separators, exponents, hex floats, rune literals with escapes),
+// so that lexers and constant conversion in compilers see all of them.
+// The spelling never changes the value, nor an integer constant into a float
+// one or vice versa. String literals contain random unicode and invalid UTF-8
+// to cover UTF-8 decoding in compilers and the runtime.
+
+// fmtInt spells the integer constant v. If runeLit is set, v can be spelled
+// as a rune literal, which turns an untyped constant into an untyped rune constant.
+func (g *Generator) fmtInt(v constant.Value, runeLit bool) string {
+	n := constBigInt(v)
+	if n.Sign() < 0 {
+		return F("(-%v)", g.fmtInt(constant.Make(new(big.Int).Neg(n)), runeLit))
+	}
+	if runeLit && g.rnd(4) == 0 {
+		if s := g.runeLit(n); s != "" {
+			return s
+		}
+	}
+	return g.spellInt(n, false)
+}
+
+// spellInt spells the non-negative integer n. The integer part of an imaginary
+// literal is decimal even with a leading 0 and gofmt removes such zeros
+// (the gofmt checker would report it), so imag disables legacy octal.
+func (g *Generator) spellInt(n *big.Int, imag bool) string {
+	op := g.choice("decimal", "hex", "octal", "binary", "legacy octal")
+	if imag && op == "legacy octal" {
+		op = "decimal"
+	}
+	switch op {
+	case "decimal":
+		return g.digits("", n.Text(10))
+	case "hex":
+		return g.digits(g.choice("0x", "0X"), g.hexCase(n.Text(16)))
+	case "octal":
+		return g.digits(g.choice("0o", "0O"), n.Text(8))
+	case "binary":
+		return g.digits(g.choice("0b", "0B"), n.Text(2))
+	case "legacy octal":
+		return g.digits("", "0"+n.Text(8))
+	default:
+		panic("bad")
+	}
+}
+
+// fmtFloat spells the constant v in floating-point syntax.
+// The value must be a multiple of 1/16, like all float constants we generate.
+func (g *Generator) fmtFloat(v constant.Value) string {
+	r := new(big.Rat).SetFrac(constBigInt(constant.Num(v)), constBigInt(constant.Denom(v)))
+	if r.Sign() < 0 {
+		return F("(-%v)", g.fmtFloat(constant.Make(r.Neg(r))))
+	}
+	// Both 1e4 and 16 are multiples of the denominator.
+	dec := new(big.Rat).Mul(r, big.NewRat(1e4, 1))
+	bin := new(big.Rat).Mul(r, big.NewRat(16, 1))
+	if !dec.IsInt() || !bin.IsInt() {
+		panic("bad")
+	}
+	switch g.choice("decimal", "exponent", "hex") {
+	case "decimal":
+		s := r.FloatString(4)
+		if g.rndBool() {
+			s = strings.TrimRight(s, "0")
+		}
+		i := strings.IndexByte(s, '.')
+		ip, fp := s[:i], s[i+1:]
+		if ip == "0" && fp != "" && g.rndBool() {
+			return "." + g.digits("", fp)
+		}
+		if fp == "" {
+			return g.digits("", ip) + "."
+		}
+		return g.digits("", ip) + "." + g.digits("", fp)
+	case "exponent":
+		m, exp := dec.Num(), -4
+		ten := big.NewInt(10)
+		for m.Sign() != 0 && new(big.Int).Rem(m, ten).Sign() == 0 {
+			m.Quo(m, ten)
+			exp++
+		}
+		return g.digits("", m.Text(10)) + g.choice("e", "E") + g.fmtExponent(exp)
+	case "hex":
+		m, exp := bin.Num(), -4
+		for m.Sign() != 0 && m.Bit(0) == 0 {
+			m.Rsh(m, 1)
+			exp++
+		}
+		s := g.digits(g.choice("0x", "0X"), g.hexCase(m.Text(16)))
+		if g.rnd(4) == 0 {
+			s += "."
+		}
+		return s + g.choice("p", "P") + g.fmtExponent(exp)
+	default:
+		panic("bad")
+	}
+}
+
+// fmtImag spells an imaginary literal with the non-negative value v (an integer or a float).
+func (g *Generator) fmtImag(v constant.Value) string {
+	if v.Kind() == constant.Int && g.rndBool() {
+		return g.spellInt(constBigInt(v), true) + "i"
+	}
+	return g.fmtFloat(v) + "i"
+}
+
+func (g *Generator) fmtExponent(exp int) string {
+	if exp >= 0 {
+		return F("%v%v", g.choice("", "+", "0"), exp)
+	}
+	return F("%v", exp)
+}
+
+// digits returns digits after prefix, possibly with digit separators.
+func (g *Generator) digits(prefix, digits string) string {
+	if g.rndBool() {
+		return prefix + digits
+	}
+	var buf bytes.Buffer
+	buf.WriteString(prefix)
+	for i, c := range digits {
+		if (i != 0 || prefix != "") && g.rnd(4) == 0 {
+			buf.WriteByte('_')
+		}
+		buf.WriteRune(c)
+	}
+	return buf.String()
+}
+
+func (g *Generator) hexCase(digits string) string {
+	if g.rndBool() {
+		return strings.ToUpper(digits)
+	}
+	return digits
+}
+
+// simpleEscapes are single-character escapes in rune and string literals.
+var simpleEscapes = map[rune]string{
+	'\a': `\a`,
+	'\b': `\b`,
+	'\f': `\f`,
+	'\n': `\n`,
+	'\r': `\r`,
+	'\t': `\t`,
+	'\v': `\v`,
+	'\\': `\\`,
+}
+
+// runeSpellings returns ways to spell the code point r inside a rune or string
+// literal with the given quote, except for \x and octal escapes that mean
+// different things in rune and string literals.
+func (g *Generator) runeSpellings(r, quote rune) []string {
+	var res []string
+	if unicode.IsPrint(r) && r != quote && r != '\\' {
+		res = append(res, string(r))
+	}
+	if e, ok := simpleEscapes[r]; ok {
+		res = append(res, e)
+	}
+	if r == quote {
+		res = append(res, `\`+string(r))
+	}
+	if r < 1<<16 {
+		res = append(res, `\u`+g.hexCase(F("%04x", r)))
+	}
+	return append(res, `\U`+g.hexCase(F("%08x", r)))
+}
+
+func (g *Generator) byteEscape(b byte) string {
+	if g.rndBool() {
+		return `\x` + g.hexCase(F("%02x", b))
+	}
+	return F(`\%03o`, b)
+}
+
+// runeLit returns a rune literal with the value n, or "" if n is not a valid code point.
+func (g *Generator) runeLit(n *big.Int) string {
+	if !n.IsInt64() {
+		return ""
+	}
+	v := n.Int64()
+	if v > unicode.MaxRune || v >= 0xd800 && v < 0xe000 {
+		return ""
+	}
+	cand := g.runeSpellings(rune(v), '\'')
+	if v < 1<<8 {
+		// In rune literals these escapes are the code point, not UTF-8 bytes.
+		cand = append(cand, g.byteEscape(byte(v)))
+	}
+	return "'" + cand[g.rnd(len(cand))] + "'"
+}
+
+// codePoint returns a random code point with a UTF-8 encoding of random length.
+func (g *Generator) codePoint() rune {
+	switch g.rnd(4) {
+	case 0:
+		return rune(g.rnd(0x80))
+	case 1:
+		return rune(0x80 + g.rnd(0x800-0x80))
+	case 2:
+		r := rune(0x800 + g.rnd(0x10000-0x800))
+		if r >= 0xd800 && r < 0xe000 {
+			// Surrogates are not valid code points.
+			r += 0x800
+		}
+		return r
+	default:
+		return rune(0x10000 + g.rnd(unicode.MaxRune+1-0x10000))
+	}
+}
+
+// specialRunes are code points interesting for lexers and UTF-8 decoding.
+var specialRunes = []rune{0, '\n', '\r', '\t', '`', '"', '\'', '\\', 0x7f, 0x80, 0xff, 0x7ff, 0x800,
+	0xfeff, 0xfffd, 0xffff, 0x10000, unicode.MaxRune}
+
+// stringValue returns a random string value, possibly empty or not valid UTF-8.
+func (g *Generator) stringValue() string {
+	var buf bytes.Buffer
+	for n := g.rnd(6); n > 0; n-- {
+		switch g.choice("ascii", "unicode", "special", "surrogate", "invalid") {
+		case "ascii":
+			buf.WriteByte(byte(g.rnd(0x80)))
+		case "unicode":
+			buf.WriteRune(g.codePoint())
+		case "special":
+			buf.WriteRune(specialRunes[g.rnd(len(specialRunes))])
+		case "surrogate":
+			// UTF-8 encoding of a surrogate, decodes as RuneError per byte.
+			r := 0xd800 + g.rnd(0x800)
+			buf.WriteString(string([]byte{0xed, byte(0x80 | r>>6&0x3f), byte(0x80 | r&0x3f)}))
+		case "invalid":
+			buf.WriteString(g.choice("\x80", "\xbf", "\xc0", "\xc0\xaf", "\xe2\x82", "\xf4\x90\x80\x80", "\xfe", "\xff"))
+		default:
+			panic("bad")
+		}
+	}
+	return buf.String()
+}
+
+// fmtString spells the string value s as an interpreted or a raw string literal.
+func (g *Generator) fmtString(s string) string {
+	// Go source can't contain NUL or BOM, and carriage returns are discarded from raw strings.
+	if utf8.ValidString(s) && !strings.ContainsAny(s, "`\r\x00\ufeff") && g.rndBool() {
+		return "`" + s + "`"
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		var cand []string
+		if r != utf8.RuneError || size != 1 {
+			cand = g.runeSpellings(r, '"')
+		}
+		// In string literals these escapes are UTF-8 bytes.
+		esc := ""
+		for j := 0; j < size; j++ {
+			esc += g.byteEscape(s[i+j])
+		}
+		cand = append(cand, esc)
+		buf.WriteString(cand[g.rnd(len(cand))])
+		i += size
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
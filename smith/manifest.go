@@ -0,0 +1,108 @@
+package smith
+
+import (
+	"encoding/json"
+)
+
+// Manifest describes what a generated program consists of,
+// gosmith writes it to manifest.json next to the program.
+type Manifest struct {
+	Seed     int64
+	Version  int     // generator version, see Version
+	Options  Options // Options.Profile is the profile actually used (e.g. after swarm)
+	Packages map[string]*Features
+}
+
+// Features counts constructs in a package. The driver sums them
+// over all tested programs.
+type Features struct {
+	Statements  map[string]int // statements by name (see StatementNames)
+	Expressions map[string]int // expressions by name (see ExpressionNames)
+	Types       map[string]int // types of declared variables by class (see ClassNames)
+
+	MaxBlockDepth int // max nesting of blocks, including function literals
+	MaxExprDepth  int // max nesting of expressions
+
+	Closures   int // function literals
+	Goroutines int // go statements
+	Defers     int // defer statements
+	CrossRefs  int // declarations referred to from another package
+}
+
+// Add adds counts of f1 to f, depths are maxed.
+func (f *Features) Add(f1 *Features) {
+	addCounts(&f.Statements, f1.Statements)
+	addCounts(&f.Expressions, f1.Expressions)
+	addCounts(&f.Types, f1.Types)
+	if f.MaxBlockDepth < f1.MaxBlockDepth {
+		f.MaxBlockDepth = f1.MaxBlockDepth
+	}
+	if f.MaxExprDepth < f1.MaxExprDepth {
+		f.MaxExprDepth = f1.MaxExprDepth
+	}
+	f.Closures += f1.Closures
+	f.Goroutines += f1.Goroutines
+	f.Defers += f1.Defers
+	f.CrossRefs += f1.CrossRefs
+}
+
+func addCounts(m *map[string]int, m1 map[string]int) {
+	for name, n := range m1 {
+		inc(m, name, n)
+	}
+}
+
+func inc(m *map[string]int, name string, n int) {
+	if *m == nil {
+		*m = make(map[string]int)
+	}
+	(*m)[name] += n
+}
+
+// classNames are names of type classes in manifests.
+var classNames = []string{
+	ClassBoolean:   "boolean",
+	ClassNumeric:   "numeric",
+	ClassComplex:   "complex",
+	ClassString:    "string",
+	ClassArray:     "array",
+	ClassSlice:     "slice",
+	ClassStruct:    "struct",
+	ClassPointer:   "pointer",
+	ClassFunction:  "function",
+	ClassInterface: "interface",
+	ClassMap:       "map",
+	ClassChan:      "chan",
+	ClassTypeParam: "typeparam",
+}
+
+// ClassNames returns names of all type classes.
+func ClassNames() []string {
+	return append([]string(nil), classNames...)
+}
+
+// features returns counters of the current package.
+func (g *Generator) features() *Features {
+	return &g.packages[g.curPackage].features
+}
+
+// manifest returns manifest.json contents for the generated program.
+func (g *Generator) manifest() []byte {
+	m := &Manifest{
+		Seed:     g.seed,
+		Version:  Version,
+		Options:  g.opts,
+		Packages: make(map[string]*Features),
+	}
+	m.Options.Profile = g.prof
+	for _, p := range g.packages {
+		if p != nil {
+			m.Packages[p.name] = &p.features
+		}
+	}
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+	return append(data, '\n')
+}
@@ -0,0 +1,237 @@
+package smith
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// Profile controls the shape of generated programs: how often every statement
+// and expression is chosen and how large the program is.
+// A profile is either built-in (see ProfileNames) or loaded from a JSON file, e.g.
+//
+//	{"statements": {"select": 10, "send": 10, "recv": 10}, "expressions": {"recv": 10}, "packages": 1}
+type Profile struct {
+	Name string // built-in profile name or profile file, set by LoadProfile
+
+	// Weights of statements, expressions and type literals by name
+	// (see StatementNames, ExpressionNames and TypeNames).
+	// Missing names have weight 1, weight 0 disables the construct.
+	Statements  map[string]int
+	Expressions map[string]int
+	Types       map[string]int
+
+	Packages       int // number of packages, including main
+	Files          int // number of files in a package
+	StmtCount      int // max number of statements in a package
+	ExprDepth      int // max nesting of expressions
+	ExprCount      int // max number of expressions in a statement
+	TotalExprCount int // max number of expressions in a package
+	TypeDepth      int // max nesting of types
+}
+
+var builtinProfiles = map[string]Profile{
+	"tiny": {
+		Packages:       1,
+		Files:          1,
+		StmtCount:      3,
+		ExprDepth:      2,
+		ExprCount:      4,
+		TotalExprCount: 10,
+		TypeDepth:      2,
+	},
+	"default": {
+		Packages:       3,
+		Files:          3,
+		StmtCount:      10,
+		ExprDepth:      4,
+		ExprCount:      10,
+		TotalExprCount: 50,
+		TypeDepth:      3,
+	},
+	// Builds of huge programs take tens of seconds, use a larger driver -timeout.
+	"huge": {
+		Packages:       3,
+		Files:          3,
+		StmtCount:      30,
+		ExprDepth:      6,
+		ExprCount:      20,
+		TotalExprCount: 1000,
+		TypeDepth:      4,
+	},
+}
+
+// ProfileNames returns names of the built-in profiles.
+func ProfileNames() []string {
+	var names []string
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultProfile returns the profile used when none is given.
+func DefaultProfile() *Profile {
+	p := builtinProfiles["default"]
+	p.Name = "default"
+	return &p
+}
+
+// LoadProfile returns the built-in profile name or loads the profile
+// from the JSON file name. Sizes missing in the file are taken from the default profile.
+func LoadProfile(name string) (*Profile, error) {
+	if p, ok := builtinProfiles[name]; ok {
+		p.Name = name
+		return &p, nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	p := DefaultProfile()
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse profile %v: %v", name, err)
+	}
+	p.Name = name
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("bad profile %v: %v", name, err)
+	}
+	return p, nil
+}
+
+// JSON returns the profile in the format of profile files.
+func (p *Profile) JSON() []byte {
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+	return append(data, '\n')
+}
+
+// Validate checks that the profile refers to existing constructs
+// and can generate a program.
+func (p *Profile) Validate() error {
+	sizes := []struct {
+		name string
+		val  int
+	}{
+		{"packages", p.Packages},
+		{"files", p.Files},
+		{"stmtcount", p.StmtCount},
+		{"exprdepth", p.ExprDepth},
+		{"exprcount", p.ExprCount},
+		{"totalexprcount", p.TotalExprCount},
+		{"typedepth", p.TypeDepth},
+	}
+	for _, s := range sizes {
+		if s.val <= 0 {
+			return fmt.Errorf("%v must be positive", s.name)
+		}
+	}
+	// Packages other than main are named a, b, c and so on.
+	if p.Packages > 27 {
+		return fmt.Errorf("packages must be at most 27")
+	}
+	if err := checkWeights("statement", p.Statements, StatementNames()); err != nil {
+		return err
+	}
+	if err := checkWeights("expression", p.Expressions, ExpressionNames()); err != nil {
+		return err
+	}
+	if err := checkWeights("type", p.Types, TypeNames()); err != nil {
+		return err
+	}
+	// Other expressions are not possible for some types.
+	if weight(p.Expressions, "literal") == 0 {
+		return fmt.Errorf("expression \"literal\" can't be disabled")
+	}
+	return nil
+}
+
+func checkWeights(what string, weights map[string]int, names []string) error {
+	known := make(map[string]bool)
+	for _, name := range names {
+		known[name] = true
+	}
+	for name, w := range weights {
+		if !known[name] {
+			return fmt.Errorf("unknown %v %q", what, name)
+		}
+		if w < 0 {
+			return fmt.Errorf("negative weight of %v %q", what, name)
+		}
+	}
+	total := 0
+	for _, name := range names {
+		total += weight(weights, name)
+	}
+	if total == 0 {
+		return fmt.Errorf("all %vs are disabled", what)
+	}
+	return nil
+}
+
+// weights returns weights of the named constructs in the order of names.
+func weights(m map[string]int, names []string) []int {
+	res := make([]int, len(names))
+	for i, name := range names {
+		res[i] = weight(m, name)
+	}
+	return res
+}
+
+func weight(m map[string]int, name string) int {
+	if w, ok := m[name]; ok {
+		return w
+	}
+	return 1
+}
+
+// weighted returns a random index into weights with probability proportional to the weight.
+func (g *Generator) weighted(weights []int) int {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	r := g.rnd(total)
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	panic("bad")
+}
+
+// swarm disables a random subset of statements, expressions and type literals
+// (swarm testing): programs dominated by a few features find more bugs
+// than programs with a little of everything.
+func (g *Generator) swarm() {
+	p := *g.prof
+	p.Statements = g.swarmWeights(g.prof.Statements, StatementNames())
+	p.Expressions = g.swarmWeights(g.prof.Expressions, ExpressionNames())
+	p.Types = g.swarmWeights(g.prof.Types, TypeNames())
+	// Other expressions are not possible for some types.
+	p.Expressions["literal"] = weight(g.prof.Expressions, "literal")
+	g.prof = &p
+}
+
+func (g *Generator) swarmWeights(m map[string]int, names []string) map[string]int {
+	for {
+		res := make(map[string]int)
+		total := 0
+		for _, name := range names {
+			w := weight(m, name)
+			if g.rndBool() {
+				w = 0
+			}
+			res[name] = w
+			total += w
+		}
+		if total != 0 {
+			return res
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package smith
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// In the safe mode (Options.Safe) generated programs have defined behavior:
+// indexes are clamped against length, dereferenced pointers, written maps and
+// called functions are non-nil, channel operations don't block, loops terminate
+// and no goroutines are started. So any runtime panic or hang is a bug.
+//
+// Safe programs are also deterministic: they don't depend on map iteration order,
+// choice between ready select cases, slice capacity or addresses. Final values of
+// all variables are folded into a checksum that main prints at exit, so that
+// the output can be compared across compilers, architectures and flags.
+// Float values are summed into a separate float checksum: the spec allows
+// fused multiply-add, so it is compared only between builds with the same
+// compiler and architecture (see ChecksumSignature).
+
+const (
+	NLoopIterations = 3  // max number of iterations of a loop in the safe mode
+	NMakeSize       = 10 // make arguments are less than this in the safe mode
+	NHashDepth      = 3  // values nested deeper are hashed with HashAny
+)
+
+// safeHelpers are declared in every package of a safe program.
+// All helpers are explicitly instantiated, so that argument types
+// don't need to match exactly.
+const safeHelpers = `
+func SafeMod(i, n int) int {
+	i %= n
+	if i < 0 {
+		i += n
+	}
+	return i
+}
+
+func SafeElem[S ~[]E, E any](s S, i int) *E {
+	if len(s) == 0 {
+		return new(E)
+	}
+	return &s[SafeMod(i, len(s))]
+}
+
+func SafeByte(s string, i int) byte {
+	if len(s) == 0 {
+		return 0
+	}
+	return s[SafeMod(i, len(s))]
+}
+
+func SafeSlice[S ~[]E, E any](s S, lo, hi int) S {
+	hi = SafeMod(hi, len(s)+1)
+	return s[SafeMod(lo, hi+1):hi]
+}
+
+func SafeSlice3[S ~[]E, E any](s S, lo, hi, max int) S {
+	max = SafeMod(max, len(s)+1)
+	hi = SafeMod(hi, max+1)
+	return s[SafeMod(lo, hi+1):hi:max]
+}
+
+func SafeAppend[S ~[]E, E any](s S, v ...E) S {
+	return append(s[:len(s):len(s)], v...)
+}
+
+func SafePtr[T any](p *T) *T {
+	if p == nil {
+		return new(T)
+	}
+	return p
+}
+
+func SafeMap[M ~map[K]V, K comparable, V any](m M) M {
+	if m == nil {
+		return make(M)
+	}
+	return m
+}
+
+func SafeSend[T any](c chan T, v T) {
+	select {
+	case c <- v:
+	default:
+	}
+}
+
+func SafeRecv[T any](c chan T) T {
+	select {
+	case v := <-c:
+		return v
+	default:
+		return *new(T)
+	}
+}
+
+func SafeRecv2[T any](c chan T) (T, bool) {
+	select {
+	case v, ok := <-c:
+		return v, ok
+	default:
+		return *new(T), false
+	}
+}
+
+var HashState uint64
+
+func HashMix(h uint64, v ...uint64) uint64 {
+	for _, x := range v {
+		h = (h ^ x) * 1099511628211
+	}
+	return h
+}
+
+func HashBool(v bool) uint64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// FloatHashState sums hashes of float values, they are not folded into
+// the checksum because fused multiply-add can legally change them.
+var FloatHashState uint64
+
+func HashFloat(v float64) uint64 {
+	h := uint64(1)
+	if v == v {
+		h = math.Float64bits(v)
+	}
+	// The sum does not depend on the order of hashing, like in HashMap.
+	FloatHashState += HashMix(0, h)
+	return 0
+}
+
+func HashComplex(v complex128) uint64 {
+	return HashMix(HashFloat(real(v)), HashFloat(imag(v)))
+}
+
+func HashString(v string) uint64 {
+	return HashSlice([]byte(v), func(b byte) uint64 { return uint64(b) })
+}
+
+func HashSlice[S ~[]E, E any](s S, f func(E) uint64) uint64 {
+	h := uint64(len(s))
+	for _, e := range s {
+		h = HashMix(h, f(e))
+	}
+	return h
+}
+
+func HashMap[M ~map[K]V, K comparable, V any](m M, f func(K, V) uint64) uint64 {
+	// The sum does not depend on iteration order.
+	h := uint64(len(m))
+	for k, v := range m {
+		h += f(k, v)
+	}
+	return h
+}
+
+func HashAny(x any) uint64 {
+	switch v := x.(type) {
+	case nil:
+		return 0
+	case bool:
+		return HashBool(v)
+	case int:
+		return uint64(uint32(v))
+	case int8:
+		return uint64(v)
+	case int16:
+		return uint64(v)
+	case int32:
+		return uint64(v)
+	case int64:
+		return uint64(v)
+	case uint:
+		return uint64(uint32(v))
+	case uint8:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case uint64:
+		return v
+	case uintptr:
+		return uint64(uint32(v))
+	case float32:
+		return HashFloat(float64(v))
+	case float64:
+		return HashFloat(v)
+	case complex64:
+		return HashComplex(complex128(v))
+	case complex128:
+		return HashComplex(v)
+	case string:
+		return HashString(v)
+	default:
+		return 1
+	}
+}
+`
+
+// safeSize returns an expression for a make argument.
+func (g *Generator) safeSize() string {
+	if g.opts.Safe {
+		return F("SafeMod(%v, %v)", g.rvalue(g.intType), NMakeSize)
+	}
+	return g.rvalue(g.intType)
+}
+
+// safePtr returns the pointer expression p of type t that is non-nil in the safe mode.
+func (g *Generator) safePtr(t *Type, p string) string {
+	if g.opts.Safe {
+		return F("SafePtr[%v](%v)", t.ktyp.id, p)
+	}
+	return p
+}
+
+// safeFunc returns the function expression f of type t that is non-nil in the safe mode.
+func (g *Generator) safeFunc(t *Type, f string) string {
+	if g.opts.Safe {
+		id := g.newId("Var")
+		return F("(func() %v { if %v := (%v); %v != nil { return %v }; return %v })()", t.id, id, f, id, id, t.complexLiteral())
+	}
+	return f
+}
+
+// zeroSized says whether values of type t may have zero size.
+// Pointers to distinct zero-sized variables may or may not be equal.
+func zeroSized(t *Type) bool {
+	switch t.class {
+	case ClassArray:
+		return t.size == 0 || zeroSized(t.ktyp)
+	case ClassStruct:
+		for _, e := range t.elems {
+			if !zeroSized(e.typ) {
+				return false
+			}
+		}
+		return true
+	case ClassTypeParam:
+		return true
+	default:
+		return false
+	}
+}
+
+// wordSized says whether size of the integer type t depends on architecture.
+func (g *Generator) wordSized(t *Type) bool {
+	b := g.basicType(t)
+	return b != nil && (b.id == "int" || b.id == "uint" || b.id == "uintptr")
+}
+
+// safeWord returns the expression x of type t converted so that its value is
+// the same on 32 and 64-bit architectures in the safe mode. Values of word-sized
+// types are kept in the 32-bit range, otherwise higher bits that differ
+// would affect division, shifts and comparisons.
+func (g *Generator) safeWord(t *Type, x string) string {
+	if !g.opts.Safe || !g.wordSized(t) {
+		return x
+	}
+	if g.basicType(t).id == "int" {
+		return F("%v(int32(%v))", t.id, x)
+	}
+	return F("%v(uint32(%v))", t.id, x)
+}
+
+// safeConversion says whether conversion of numeric type from to type to
+// gives the same result on all implementations for all values.
+func (g *Generator) safeConversion(from, to *Type) bool {
+	if !g.opts.Safe {
+		return true
+	}
+	if g.isFloat(from.utyp) && !g.isFloat(to.utyp) {
+		// Out of range float to integer conversion is implementation-specific.
+		return false
+	}
+	if g.wordSized(from) && !g.wordSized(to) {
+		// The value may be different on 32 and 64-bit architectures.
+		b := g.basicType(to)
+		return b != nil && !g.isFloat(b) && b.id != "int64" && b.id != "uint64"
+	}
+	return true
+}
+
+// hashExpr returns an uint64 expression that hashes the value x of type t.
+func (g *Generator) hashExpr(t *Type, x string, depth int) string {
+	if depth >= NHashDepth {
+		return F("HashAny(%v)", x)
+	}
+	switch t.class {
+	case ClassBoolean:
+		return F("HashBool(bool(%v))", x)
+	case ClassNumeric:
+		if g.isFloat(t.utyp) {
+			return F("HashFloat(float64(%v))", x)
+		}
+		if g.wordSized(t) {
+			// Only low bits are the same on 32 and 64-bit architectures.
+			return F("uint64(uint32(%v))", x)
+		}
+		return F("uint64(%v)", x)
+	case ClassComplex:
+		return F("HashComplex(complex128(%v))", x)
+	case ClassString:
+		return F("HashString(string(%v))", x)
+	case ClassPointer, ClassFunction:
+		// Only nil-ness, addresses differ between implementations.
+		return F("HashBool(%v != nil)", x)
+	case ClassChan:
+		return F("HashMix(HashBool(%v != nil), uint64(len(%v)))", x, x)
+	case ClassInterface, ClassTypeParam:
+		return F("HashAny(%v)", x)
+	case ClassSlice:
+		e := g.newId("Var")
+		return F("HashSlice[%v](%v, func(%v %v) uint64 { return %v })",
+			t.id, x, e, t.ktyp.id, g.hashExpr(t.ktyp, e, depth+1))
+	case ClassMap:
+		k := g.newId("Var")
+		v := g.newId("Var")
+		return F("HashMap[%v](%v, func(%v %v, %v %v) uint64 { return HashMix(%v, %v) })",
+			t.id, x, k, t.ktyp.id, v, t.vtyp.id, g.hashExpr(t.ktyp, k, depth+1), g.hashExpr(t.vtyp, v, depth+1))
+	case ClassArray:
+		var list []string
+		for i := 0; i < t.size; i++ {
+			list = append(list, g.hashExpr(t.ktyp, F("%v[%v]", x, i), depth+1))
+		}
+		return hashList(x, list)
+	case ClassStruct:
+		var list []string
+		for _, e := range t.elems {
+			list = append(list, g.hashExpr(e.typ, F("%v.%v", x, e.id), depth+1))
+		}
+		return hashList(x, list)
+	default:
+		panic("bad")
+	}
+}
+
+// hashList combines hashes of elements of the composite value x.
+func hashList(x string, list []string) string {
+	if len(list) == 0 {
+		// Still refer to x, so that it is used.
+		return F("HashAny(%v)", x)
+	}
+	return F("HashMix(0, %v)", strings.Join(list, ", "))
+}
+
+// genChecksum emits the function that returns checksum of the package p
+// and all packages it imports.
+func (g *Generator) genChecksum(w io.Writer, p *Package) {
+	list := []string{"HashState"}
+	for _, v := range p.toplevVars {
+		list = append(list, g.hashExpr(v.typ, v.id, 0))
+	}
+	for _, b := range p.top.sub {
+		for _, v := range b.vars {
+			list = append(list, g.hashExpr(v.typ, v.id, 0))
+		}
+	}
+	var imports []string
+	for imp := range p.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	for _, imp := range imports {
+		list = append(list, imp+".Checksum()")
+	}
+	fmt.Fprintf(w, "func Checksum() uint64 {\n")
+	fmt.Fprintf(w, "	return HashMix(%v)\n", strings.Join(list, ", "))
+	fmt.Fprintf(w, "}\n")
+	// Float values are hashed by Checksum, so FloatChecksum must be called after it.
+	floats := []string{"FloatHashState"}
+	for _, imp := range imports {
+		floats = append(floats, imp+".FloatChecksum()")
+	}
+	fmt.Fprintf(w, "func FloatChecksum() uint64 {\n")
+	fmt.Fprintf(w, "	return %v\n", strings.Join(floats, " + "))
+	fmt.Fprintf(w, "}\n")
+}
@@ -0,0 +1,169 @@
+package smith
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Failure signatures group failures of generated programs found by the driver,
+// reduce uses them to check that a reduced program still fails the same way.
+
+var (
+	posRe   = regexp.MustCompile(`[^\s:]*\.go:[0-9]+(:[0-9]+)?:? ?`)
+	numRe   = regexp.MustCompile(`0x[0-9a-fA-F]+|[0-9]+`)
+	msgRe   = regexp.MustCompile(`internal compiler error|panic: |fatal error: |unexpected |SIG[A-Z]+|Aborted|DATA RACE|Signal [0-9]+`)
+	frameRe = regexp.MustCompile(`^([^\s(]+)\(.*\)$`)
+
+	checksumRe = regexp.MustCompile(`checksum: ([0-9]+) float: ([0-9]+)`)
+	lineRe     = regexp.MustCompile(`([^\s:]+\.go):([0-9]+)`)
+)
+
+// Signature returns a normalized description of the failure with the name:
+// the first error message and the top stack frames without positions and numbers.
+func Signature(name string, out []byte) string {
+	const maxFrames = 3
+	msg := ""
+	var frames []string
+	for _, ln := range strings.Split(string(out), "\n") {
+		if msg == "" && (msgRe.MatchString(ln) || posRe.MatchString(ln)) {
+			msg = ln
+		}
+		if m := frameRe.FindStringSubmatch(ln); m != nil && len(frames) < maxFrames && !skipFrame(m[1]) {
+			frames = append(frames, m[1])
+		}
+	}
+	if msg == "" {
+		for _, ln := range strings.Split(string(out), "\n") {
+			if ln != "" && !strings.HasPrefix(ln, "#") {
+				msg = ln
+				break
+			}
+		}
+	}
+	sig := strings.TrimSpace(posRe.ReplaceAllString(msg, ""))
+	if len(frames) != 0 {
+		sig += " [" + strings.Join(frames, " ") + "]"
+	}
+	return name + ": " + numRe.ReplaceAllString(sig, "N")
+}
+
+// skipFrame says whether the stack frame of function fn is not interesting for Signature:
+// panic machinery and generated code that is different in every program.
+func skipFrame(fn string) bool {
+	// Generated packages are main, a, b, c and so on.
+	if len(fn) > 2 && fn[0] >= 'a' && fn[0] <= 'z' && fn[1] == '.' {
+		return true
+	}
+	for _, prefix := range []string{"main.", "prog/", "panic(", "runtime.gopanic", "runtime.panic",
+		"runtime.sigpanic", "runtime.throw", "runtime.fatal", "created by "} {
+		if strings.HasPrefix(fn, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checksum is the output of a safe program: checksum of final values of all variables
+// and the separate checksum of float values.
+type Checksum struct {
+	Sum   string
+	Float string
+}
+
+// ParseChecksum returns the checksum printed by a safe program.
+func ParseChecksum(out []byte) (Checksum, bool) {
+	m := checksumRe.FindSubmatch(out)
+	if m == nil {
+		return Checksum{}, false
+	}
+	return Checksum{string(m[1]), string(m[2])}, true
+}
+
+// ChecksumSignature compares checksums of the program built as different variants
+// (gc..amd64, gc..amd64.noopt, gccgo..amd64, ssa) and returns the partition of the variants
+// by the mismatching checksum, or "" if the checksums agree. The spec allows fused
+// multiply-add, which gccgo and gc on some architectures do, so float checksums
+// are compared only between variants that differ in race and noopt flags.
+// Floats that flow into other variables through conversions and comparisons
+// can still differ by fused multiply-add, such mismatches need to be checked by hand.
+func ChecksumSignature(sums map[string]Checksum) string {
+	all := make(map[string]string)
+	for typ, sum := range sums {
+		all[typ] = sum.Sum
+	}
+	if p := partition(all); p != "" {
+		return "checksum: " + p
+	}
+	groups := make(map[string]map[string]string)
+	for typ, sum := range sums {
+		group := strings.TrimSuffix(strings.TrimSuffix(typ, ".noopt"), ".race")
+		if groups[group] == nil {
+			groups[group] = make(map[string]string)
+		}
+		groups[group][typ] = sum.Float
+	}
+	var parts []string
+	for _, group := range groups {
+		if p := partition(group); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	sort.Strings(parts)
+	return "checksum.float: " + strings.Join(parts, " || ")
+}
+
+// partition returns the partition of variants by value, or "" if all values are equal.
+func partition(sums map[string]string) string {
+	groups := make(map[string][]string)
+	for typ, sum := range sums {
+		groups[sum] = append(groups[sum], typ)
+	}
+	if len(groups) <= 1 {
+		return ""
+	}
+	var parts []string
+	for _, group := range groups {
+		sort.Strings(group)
+		parts = append(parts, strings.Join(group, ","))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " | ")
+}
+
+// TypesVerdict compares verdicts of gc (its output and whether it accepts the program)
+// and go/types (its errors) on the program. It returns "" if they agree, otherwise
+// the disagreement and the output that describes it.
+func TypesVerdict(gcOut []byte, gcAccepts bool, typesOut []byte) (string, []byte) {
+	typesAccepts := len(typesOut) == 0
+	switch {
+	case gcAccepts && typesAccepts:
+		return "", nil
+	case !gcAccepts && typesAccepts:
+		return "gc rejects", gcOut
+	case gcAccepts && !typesAccepts:
+		return "go/types rejects", typesOut
+	default:
+		gcLines, typesLines := errorLines(gcOut), errorLines(typesOut)
+		for ln := range gcLines {
+			if typesLines[ln] {
+				return "", nil
+			}
+		}
+		return "different errors", gcOut
+	}
+}
+
+// errorLines returns positions (package/file:line) of errors in compiler or go/types output.
+func errorLines(out []byte) map[string]bool {
+	lines := make(map[string]bool)
+	for _, m := range lineRe.FindAllSubmatch(out, -1) {
+		fname := string(m[1])
+		lines[filepath.Base(filepath.Dir(fname))+"/"+filepath.Base(fname)+":"+string(m[2])] = true
+	}
+	return lines
+}
@@ -0,0 +1,680 @@
+package smith
+
+import (
+	_ "fmt"
+	"strings"
+)
+
+// stmtKind is a kind of statement, profiles refer to it by name.
+type stmtKind struct {
+	name string
+	gen  func(g *Generator)
+}
+
+// statementKinds returns all kinds of statements.
+func statementKinds() []stmtKind {
+	return []stmtKind{
+		{"oas", (*Generator).stmtOas},
+		{"as", (*Generator).stmtAs},
+		{"opassign", (*Generator).stmtOpAssign},
+		{"inc", (*Generator).stmtInc},
+		{"if", (*Generator).stmtIf},
+		{"for", (*Generator).stmtFor},
+		{"send", (*Generator).stmtSend},
+		{"recv", (*Generator).stmtRecv},
+		{"select", (*Generator).stmtSelect},
+		{"switch", (*Generator).stmtSwitchExpr},
+		{"typeswitch", (*Generator).stmtSwitchType},
+		{"typeassert", (*Generator).stmtTypeAssert},
+		{"typedecl", (*Generator).stmtTypeDecl},
+		{"vardecl", (*Generator).stmtVarDecl},
+		{"constdecl", (*Generator).stmtConstDecl},
+		{"call", (*Generator).stmtCall},
+		{"return", (*Generator).stmtReturn},
+		{"break", (*Generator).stmtBreak},
+		{"continue", (*Generator).stmtContinue},
+		{"goto", (*Generator).stmtGoto},
+		{"sink", (*Generator).stmtSink},
+	}
+}
+
+// StatementNames returns names of all statements in the order of generation.
+func StatementNames() []string {
+	var names []string
+	for _, s := range statementKinds() {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+func (g *Generator) initStatements() {
+	g.statements = statementKinds()
+	g.stmtWeights = weights(g.prof.Statements, StatementNames())
+}
+
+func (g *Generator) genStatement() {
+	if g.stmtCount >= g.prof.StmtCount {
+		return
+	}
+	g.exprCount = 0
+	g.stmtCount++
+	s := g.statements[g.weighted(g.stmtWeights)]
+	inc(&g.features().Statements, s.name, 1)
+	s.gen(g)
+}
+
+func (g *Generator) stmtOas() {
+	list := g.atypeList(TraitAny)
+	str, vars := g.fmtOasVarList(list)
+	g.line("%v := %v", str, g.fmtRvalueList(list))
+	for _, v := range vars {
+		g.defineVar(v.id, v.typ)
+	}
+}
+
+func (g *Generator) stmtReturn() {
+	g.line("return %v", g.fmtRvalueList(g.curFunc.rets))
+}
+
+func (g *Generator) stmtAs() {
+	types := g.atypeList(TraitAny)
+	g.line("%v = %v", g.fmtLvalueList(types), g.fmtRvalueList(types))
+}
+
+func (g *Generator) stmtOpAssign() {
+	g.line("%v", g.opAssign())
+}
+
+// opAssign returns an assignment operation x op= y. In the safe mode
+// word-sized values are normalized (see safeWord), so it is x = x op y.
+func (g *Generator) opAssign() string {
+	var t *Type
+	switch g.choice("numeric", "complex", "ordered") {
+	case "numeric":
+		t = g.atype(ClassNumeric)
+	case "complex":
+		t = g.atype(ClassComplex)
+	case "ordered":
+		// Strings and type parameters.
+		t = g.atype(TraitOrdered)
+	default:
+		panic("bad")
+	}
+	x := g.lvalueOrMapIndex(t)
+	op := g.choice(g.arithOps(t)...)
+	y := g.arithOperand(t, op)
+	if g.opts.Safe && g.wordSized(t) {
+		return F("%v = %v", x, g.safeWord(t, F("(%v) %v %v", x, op, y)))
+	}
+	return F("%v %v= %v", x, op, y)
+}
+
+func (g *Generator) stmtInc() {
+	g.line("%v", g.incDec())
+}
+
+// incDec returns an increment or decrement statement, word-sized values
+// are normalized in the safe mode (see safeWord).
+func (g *Generator) incDec() string {
+	t := g.atype(ClassNumeric)
+	x := g.lvalueOrMapIndex(t)
+	op := g.choice("--", "++")
+	if g.opts.Safe && g.wordSized(t) {
+		return F("%v = %v", x, g.safeWord(t, F("(%v) %v 1", x, op[:1])))
+	}
+	return F("%v %v", x, op)
+}
+
+func (g *Generator) stmtIf() {
+	g.enterBlock(true)
+	g.enterBlock(true)
+	if g.rndBool() {
+		g.line("if %v {", g.rvalue(g.atype(ClassBoolean)))
+	} else {
+		g.line("if %v; %v {", g.stmtSimple(true, nil), g.rvalue(g.atype(ClassBoolean)))
+	}
+	g.genBlock()
+	if g.rndBool() {
+		g.line("} else {")
+		g.genBlock()
+	}
+	g.leaveBlock()
+	g.line("}")
+	g.leaveBlock()
+}
+
+func (g *Generator) stmtFor() {
+	g.enterBlock(true)
+	cnt := ""
+	if g.opts.Safe {
+		// Bound the number of iterations.
+		cnt = g.newId("Var")
+		g.line("%v := 0", cnt)
+	}
+	g.enterBlock(true)
+	g.curBlock.isBreakable = true
+	g.curBlock.isContinuable = true
+	var vars []*Var
+	switch g.choice("simple", "complex", "range") {
+	case "simple":
+		g.line("for %v {", g.rvalue(g.atype(ClassBoolean)))
+	case "complex":
+		g.line("for %v; %v; %v {", g.stmtSimple(true, nil), g.rvalue(g.atype(ClassBoolean)), g.stmtSimple(false, nil))
+	case "range":
+		kinds := []string{"slice", "string", "channel", "map"}
+		if g.opts.Safe {
+			// Range over a channel blocks until the channel is closed,
+			// order of map iteration is not specified.
+			kinds = []string{"slice", "string"}
+		}
+		switch g.choice(kinds...) {
+		case "slice":
+			t := g.atype(TraitAny)
+			s := g.rvalue(g.sliceOf(t))
+			switch g.choice("one", "two", "oneDecl", "twoDecl") {
+			case "one":
+				g.line("for %v = range %v {", g.lvalueOrBlank(g.intType), s)
+			case "two":
+				g.line("for %v, %v = range %v {", g.lvalueOrBlank(g.intType), g.lvalueOrBlank(t), s)
+			case "oneDecl":
+				id := g.newId("Var")
+				g.line("for %v := range %v {", id, s)
+				vars = append(vars, &Var{id: id, typ: g.intType})
+			case "twoDecl":
+				types := []*Type{g.intType, t}
+				str := ""
+				str, vars = g.fmtOasVarList(types)
+				g.line("for %v := range %v {", str, s)
+			default:
+				panic("bad")
+			}
+		case "string":
+			s := g.rvalue(g.stringType)
+			switch g.choice("one", "two", "oneDecl", "twoDecl") {
+			case "one":
+				g.line("for %v = range %v {", g.lvalueOrBlank(g.intType), s)
+			case "two":
+				g.line("for %v, %v = range %v {", g.lvalueOrBlank(g.intType), g.lvalueOrBlank(g.runeType), s)
+			case "oneDecl":
+				id := g.newId("Var")
+				g.line("for %v := range %v {", id, s)
+				vars = append(vars, &Var{id: id, typ: g.intType})
+			case "twoDecl":
+				types := []*Type{g.intType, g.runeType}
+				str := ""
+				str, vars = g.fmtOasVarList(types)
+				g.line("for %v := range %v {", str, s)
+			default:
+				panic("bad")
+			}
+		case "channel":
+			cht := g.atype(ClassChan)
+			ch := g.rvalue(cht)
+			switch g.choice("one", "oneDecl") {
+			case "one":
+				g.line("for %v = range %v {", g.lvalueOrBlank(cht.ktyp), ch)
+			case "oneDecl":
+				id := g.newId("Var")
+				g.line("for %v := range %v {", id, ch)
+				vars = append(vars, &Var{id: id, typ: cht.ktyp})
+			default:
+				panic("bad")
+			}
+		case "map":
+			t := g.atype(ClassMap)
+			m := g.rvalue(t)
+			switch g.choice("one", "two", "oneDecl", "twoDecl") {
+			case "one":
+				g.line("for %v = range %v {", g.lvalueOrBlank(t.ktyp), m)
+			case "two":
+				g.line("for %v, %v = range %v {", g.lvalueOrBlank(t.ktyp), g.lvalueOrBlank(t.vtyp), m)
+			case "oneDecl":
+				id := g.newId("Var")
+				g.line("for %v := range %v {", id, m)
+				vars = append(vars, &Var{id: id, typ: t.ktyp})
+			case "twoDecl":
+				types := []*Type{t.ktyp, t.vtyp}
+				str := ""
+				str, vars = g.fmtOasVarList(types)
+				g.line("for %v := range %v {", str, m)
+			default:
+				panic("bad")
+			}
+		default:
+			panic("bad")
+		}
+	default:
+		panic("bad")
+	}
+	g.enterBlock(true)
+	if cnt != "" {
+		g.line("if %v >= %v { break }", cnt, NLoopIterations)
+		g.line("%v++", cnt)
+	}
+	if len(vars) > 0 {
+		g.line("")
+		for _, v := range vars {
+			g.defineVar(v.id, v.typ)
+		}
+	}
+	g.genBlock()
+	g.leaveBlock()
+	g.leaveBlock()
+	g.line("}")
+	g.leaveBlock()
+}
+
+func (g *Generator) stmtSimple(oas bool, newVars *[]*Var) string {
+	// We emit a fake statement in "oas", so make sure that nothing can be inserted in between.
+	if g.curBlock.extendable {
+		panic("bad")
+	}
+	// "send" crashes gccgo with random errors too frequently.
+	// https://gcc.gnu.org/bugzilla/show_bug.cgi?id=61273
+	switch g.choice("empty", "inc", "assign", "opassign", "oas", "send", "expr") {
+	case "empty":
+		return ""
+	case "inc":
+		return g.incDec()
+	case "opassign":
+		return g.opAssign()
+	case "assign":
+		list := g.atypeList(TraitAny)
+		return F("%v = %v", g.fmtLvalueList(list), g.fmtRvalueList(list))
+	case "oas":
+		if !oas {
+			return ""
+		}
+		list := g.atypeList(TraitAny)
+		str, vars := g.fmtOasVarList(list)
+		if newVars != nil {
+			*newVars = vars
+		}
+		res := F("%v := %v", str, g.fmtRvalueList(list))
+		g.line("")
+		for _, v := range vars {
+			g.defineVar(v.id, v.typ)
+		}
+		return res
+	case "send":
+		t := g.atype(TraitSendable)
+		if g.opts.Safe {
+			return F("SafeSend[%v](%v, %v)", t.ktyp.id, g.rvalue(t), g.rvalue(t.ktyp))
+		}
+		return F("%v <- %v", g.rvalue(t), g.rvalue(t.ktyp))
+	case "expr":
+		return ""
+	default:
+		panic("bad")
+	}
+}
+
+func (g *Generator) stmtSend() {
+	t := g.atype(TraitSendable)
+	if g.opts.Safe {
+		g.line("SafeSend[%v](%v, %v)", t.ktyp.id, g.rvalue(t), g.rvalue(t.ktyp))
+		return
+	}
+	g.line("%v <- %v", g.rvalue(t), g.rvalue(t.ktyp))
+}
+
+func (g *Generator) stmtRecv() {
+	t := g.atype(TraitReceivable)
+	ch := F("<-%v", g.rvalue(t))
+	if g.opts.Safe {
+		ch = F("SafeRecv2[%v](%v)", t.ktyp.id, g.rvalue(t))
+	}
+	switch g.choice("normal", "decl") {
+	case "normal":
+		g.line("%v, %v = %v", g.lvalueOrBlank(t.ktyp), g.lvalueOrBlank(g.boolType), ch)
+	case "decl":
+		vv := g.newId("Var")
+		ok := g.newId("Var")
+		g.line("%v, %v := %v", vv, ok, ch)
+		g.defineVar(vv, t.ktyp)
+		g.defineVar(ok, g.boolType)
+	default:
+		panic("bad")
+	}
+}
+
+func (g *Generator) stmtTypeDecl() {
+	if g.rnd(4) == 0 {
+		defer g.saveContext()()
+		g.genGenericType(g.curPackage)
+		return
+	}
+	id := g.newId("Type")
+	t := g.atype(TraitAny)
+	if t.class == ClassTypeParam {
+		// A type parameter can't be used as the underlying type.
+		return
+	}
+
+	newTyp := namedType(id, t)
+	if g.rndBool() && !dependsOn(t, nil) {
+		// Declare the type at package level, so that it can have methods.
+		defer g.saveContext()()
+		g.genToplevType(g.curPackage, newTyp)
+		if newTyp.class != ClassPointer && newTyp.class != ClassInterface {
+			g.genMethods(newTyp)
+		}
+		return
+	}
+	g.line("type %v %v", id, t.id)
+	g.defineType(newTyp)
+}
+
+func (g *Generator) stmtVarDecl() {
+	id := g.newId("Var")
+	t := g.atype(TraitAny)
+	g.line("var %v %v = %v", id, t.id, g.rvalue(t))
+	g.defineVar(id, t)
+}
+
+func (g *Generator) stmtConstDecl() {
+	if g.rndBool() {
+		for _, c := range g.genConstDecl() {
+			g.defineConst(c)
+		}
+		return
+	}
+	// Declare the constants at package level, so that they are visible in all functions.
+	defer g.saveContext()()
+	g.genToplevConst(g.curPackage)
+}
+
+// genConstDecl emits a constant declaration and returns the declared constants.
+func (g *Generator) genConstDecl() []*Const {
+	t, typed := g.constType()
+	typ := ""
+	if typed {
+		typ = t.id
+	}
+	var ct *Type
+	if typed {
+		ct = t
+	}
+	b := g.basicType(t)
+	if b.class != ClassNumeric || g.rndBool() {
+		id := g.newId("Const")
+		s, v, _ := g.constExpr(t, typed, 0)
+		g.line("const %v %v = %v", id, typ, s)
+		return []*Const{&Const{id: id, typ: ct, val: v}}
+	}
+	n := g.rnd(4) + 1
+	s, vals := g.iotaExpr(t, typed, n)
+	var list []*Const
+	for i := range vals {
+		if i != 0 && g.rnd(4) == 0 {
+			list = append(list, &Const{id: "_"})
+			continue
+		}
+		list = append(list, &Const{id: g.newId("Const"), typ: ct, val: vals[i]})
+	}
+	// The block is emitted as a single line, so that nothing is inserted in between.
+	str := "const (\n"
+	for i, c := range list {
+		if i == 0 {
+			str += F("%v %v = %v\n", c.id, typ, s)
+		} else {
+			str += F("%v\n", c.id)
+		}
+	}
+	g.line("%v)", str)
+	var res []*Const
+	for _, c := range list {
+		if c.id != "_" {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func (g *Generator) stmtSelect() {
+	g.enterBlock(true)
+	g.line("select {")
+	for n := 0; g.rnd(5) != 0; n++ {
+		if g.opts.Safe && n == 1 {
+			// Choice between several ready cases is random.
+			break
+		}
+		g.enterBlock(true)
+		elem := g.atype(TraitAny)
+		cht := g.chanOf(elem)
+		ch := g.rvalue(cht)
+		if g.rndBool() {
+			g.line("case %v <- %v:", ch, g.rvalue(elem))
+		} else {
+			switch g.choice("one", "two", "oneDecl", "twoDecl") {
+			case "one":
+				g.line("case %v = <-%v:", g.lvalueOrBlank(elem), ch)
+			case "two":
+				g.line("case %v, %v = <-%v:", g.lvalueOrBlank(elem), g.lvalueOrBlank(g.boolType), ch)
+			case "oneDecl":
+				vv := g.newId("Var")
+				g.line("case %v := <-%v:", vv, ch)
+				g.defineVar(vv, elem)
+			case "twoDecl":
+				vv := g.newId("Var")
+				ok := g.newId("Var")
+				g.line("case %v, %v := <-%v:", vv, ok, ch)
+				g.defineVar(vv, elem)
+				g.defineVar(ok, g.boolType)
+			default:
+				panic("bad")
+			}
+		}
+		g.genBlock()
+		g.leaveBlock()
+	}
+	if g.opts.Safe || g.rndBool() {
+		g.enterBlock(true)
+		g.line("default:")
+		g.genBlock()
+		g.leaveBlock()
+	}
+	g.line("}")
+	g.leaveBlock()
+}
+
+func (g *Generator) stmtSwitchExpr() {
+	var t *Type
+	cond := ""
+	if g.rndBool() {
+		t = g.atype(TraitComparable)
+		cond = g.rvalue(t)
+	} else {
+		t = g.boolType
+	}
+	g.enterBlock(true)
+	g.enterBlock(true)
+	g.curBlock.isBreakable = true
+	var vars []*Var
+	if g.rndBool() {
+		g.line("switch %v {", cond)
+	} else {
+		g.line("switch %v; %v {", g.stmtSimple(true, &vars), cond)
+	}
+	// TODO: we generate at most one case, because if we generate more,
+	// we can generate two cases with equal constants.
+	fallth := false
+	if g.rndBool() {
+		g.enterBlock(true)
+		g.line("case %v:", g.rvalue(t))
+		g.genBlock()
+		g.leaveBlock()
+		if g.rndBool() {
+			fallth = true
+			g.line("fallthrough")
+		}
+	}
+	if fallth || len(vars) > 0 || g.rndBool() {
+		g.enterBlock(true)
+		g.line("default:")
+		g.genBlock()
+		for _, v := range vars {
+			g.line("_ = %v", v.id)
+			v.used = true
+		}
+		g.leaveBlock()
+	}
+	g.leaveBlock()
+	g.line("}")
+	g.leaveBlock()
+}
+
+func (g *Generator) stmtSwitchType() {
+	var it, t *Type
+	cond := ""
+	if g.rndBool() {
+		t = g.atype(TraitAny)
+		it = g.efaceType
+		cond = F("(interface{})(%v)", g.lvalue(t))
+	} else {
+		it = g.atype(ClassInterface)
+		cond = g.rvalue(it)
+	}
+	id := g.newId("Var")
+	g.enterBlock(true)
+	g.curBlock.isBreakable = true
+	g.line("switch %v := (%v).(type) {", id, cond)
+	used := false
+	seen := make(map[string]bool)
+	// Spelling of identical types can differ in whitespace and aliases.
+	key := func(t *Type) string {
+		return strings.Join(strings.Fields(aliasRe.ReplaceAllStringFunc(t.id, unalias)), "")
+	}
+	for g.rnd(3) != 0 {
+		ct := t
+		if ct == nil || g.rndBool() {
+			ct = g.implementation(it)
+		}
+		if ct == nil || seen[key(ct)] {
+			continue
+		}
+		seen[key(ct)] = true
+		g.enterBlock(true)
+		g.line("case %v:", ct.id)
+		g.defineVar(id, ct)
+		used = true
+		g.genBlock()
+		g.leaveBlock()
+	}
+	if g.rndBool() {
+		g.enterBlock(true)
+		g.line("case nil:")
+		g.genBlock()
+		g.leaveBlock()
+	}
+	if !used || g.rndBool() {
+		g.enterBlock(true)
+		g.line("default:")
+		g.defineVar(id, it)
+		g.genBlock()
+		g.leaveBlock()
+	}
+	g.line("}")
+	g.leaveBlock()
+}
+
+func (g *Generator) stmtTypeAssert() {
+	t := g.atype(TraitAny)
+	x := g.rvalue(g.ifaceOf(t))
+	switch g.choice("normal", "decl") {
+	case "normal":
+		g.line("%v, %v = (%v).(%v)", g.lvalueOrBlank(t), g.lvalueOrBlank(g.boolType), x, t.id)
+	case "decl":
+		vv := g.newId("Var")
+		ok := g.newId("Var")
+		g.line("%v, %v := (%v).(%v)", vv, ok, x, t.id)
+		g.defineVar(vv, t)
+		g.defineVar(ok, g.boolType)
+	default:
+		panic("bad")
+	}
+}
+
+func (g *Generator) stmtCall() {
+	if g.rndBool() {
+		g.stmtCallBuiltin()
+	}
+	t := g.atype(ClassFunction)
+	g.line("%v %v(%v)", g.callPrefix(), g.safeFunc(t, g.rvalue(t)), g.fmtArgList(t.styp, t.variadic))
+}
+
+// callPrefix returns a random prefix of a call statement.
+// Goroutines are not started in the safe mode, because they may outlive main.
+func (g *Generator) callPrefix() string {
+	prefix := ""
+	if g.opts.Safe {
+		prefix = g.choice("", "defer")
+	} else {
+		prefix = g.choice("", "go", "defer")
+	}
+	switch prefix {
+	case "go":
+		g.features().Goroutines++
+	case "defer":
+		g.features().Defers++
+	}
+	return prefix
+}
+
+func (g *Generator) stmtCallBuiltin() {
+	prefix := g.callPrefix()
+	fns := []string{"close", "copy", "delete", "panic", "print", "println", "recover"}
+	if g.opts.Safe {
+		// Operations on a closed channel panic.
+		fns = []string{"copy", "delete", "print", "println", "recover"}
+	}
+	switch fn := g.choice(fns...); fn {
+	case "close":
+		g.line("%v %v(%v)", prefix, fn, g.rvalue(g.atype(ClassChan)))
+	case "copy":
+		g.line("%v %v", prefix, g.exprCopySlice())
+	case "delete":
+		t := g.atype(ClassMap)
+		g.line("%v %v(%v, %v)", prefix, fn, g.rvalue(t), g.rvalue(t.ktyp))
+	case "panic":
+		g.line("%v %v(%v)", prefix, fn, g.rvalue(g.atype(TraitAny)))
+	case "print":
+		fallthrough
+	case "println":
+		list := g.atypeList(TraitPrintable)
+		g.line("%v %v(%v)", prefix, fn, g.fmtRvalueList(list))
+	case "recover":
+		g.line("%v %v()", prefix, fn)
+	default:
+		panic("bad")
+	}
+}
+
+func (g *Generator) stmtBreak() {
+	if !g.curBlock.isBreakable {
+		return
+	}
+	g.line("break")
+}
+
+func (g *Generator) stmtContinue() {
+	if !g.curBlock.isContinuable {
+		return
+	}
+	g.line("continue")
+}
+
+func (g *Generator) stmtGoto() {
+	// TODO: suppport goto down
+	id, cnt := g.materializeGotoLabel()
+	if cnt != "" {
+		g.line("if %v < %v { %v++; goto %v }", cnt, NLoopIterations, cnt, id)
+		return
+	}
+	g.line("goto %v", id)
+}
+
+func (g *Generator) stmtSink() {
+	// Makes var escape.
+	g.line("SINK = %v", g.exprVar(g.atype(TraitAny)))
+}
@@ -0,0 +1,837 @@
+package smith
+
+import (
+	"bytes"
+	"fmt"
+	"go/constant"
+	"regexp"
+)
+
+type TypeClass int
+
+const (
+	ClassBoolean TypeClass = iota
+	ClassNumeric
+	ClassComplex
+	ClassString
+	ClassArray
+	ClassSlice
+	ClassStruct
+	ClassPointer
+	ClassFunction
+	ClassInterface
+	ClassMap
+	ClassChan
+	ClassTypeParam
+
+	TraitAny
+	TraitOrdered
+	TraitComparable
+	TraitIndexable
+	TraitReceivable
+	TraitSendable
+	TraitHashable
+	TraitPrintable
+	TraitLenCapable
+	TraitGlobal
+)
+
+type Type struct {
+	id             string
+	class          TypeClass
+	namedUserType  bool
+	ktyp           *Type   // map key, chan elem, array elem, slice elem, pointee type
+	vtyp           *Type   // map val
+	utyp           *Type   // underlying type
+	styp           []*Type // function arguments
+	rtyp           []*Type // function return values
+	elems          []*Var  // struct fileds and interface methods
+	variadic       bool    // function with final parameter ...T, the last of styp is []T
+	size           int     // array length
+	methods        []*Func // methods declared on a named type
+	literal        func() string
+	complexLiteral func() string
+
+	// Generics.
+	constraint *Type                     // constraint of a type parameter
+	terms      []*Type                   // type set of a constraint, empty if it is defined by methods
+	tilde      bool                      // constraint terms are ~T
+	tparams    []*Type                   // type parameters of a generic type
+	targs      []*Type                   // type arguments of an instantiated type
+	generic    *Type                     // generic type of an instantiated type
+	instances  map[string]*Type          // instantiations of a generic type
+	underlying func(targs []*Type) *Type // underlying type of an instantiation
+
+	// TODO: cache types
+	// pointerTo *Type
+}
+
+func (g *Generator) initTypes() {
+	g.typeWeights = weights(g.prof.Types, typeLitNames)
+	zero, one := constant.MakeInt64(0), constant.MakeInt64(1)
+	// conv returns the literal v of the numeric type id.
+	conv := func(id string, v constant.Value) func() string {
+		return func() string { return F("%v(%v)", id, g.fmtInt(v, true)) }
+	}
+	g.predefinedTypes = []*Type{
+		&Type{id: "string", class: ClassString, literal: func() string { return g.fmtString(g.stringValue()) }},
+		&Type{id: "bool", class: ClassBoolean, literal: func() string { return "false" }},
+		&Type{id: "int", class: ClassNumeric, literal: func() string { return g.fmtInt(one, false) }},
+		&Type{id: "byte", class: ClassNumeric, literal: conv("byte", zero)},
+		&Type{id: "interface{}", class: ClassInterface, literal: func() string { return "interface{}(nil)" }},
+		&Type{id: "rune", class: ClassNumeric, literal: conv("rune", zero)},
+		&Type{id: "float32", class: ClassNumeric, literal: func() string { return F("float32(%v)", g.fmtFloat(one)) }},
+		&Type{id: "float64", class: ClassNumeric, literal: func() string { return g.fmtFloat(one) }},
+		&Type{id: "complex64", class: ClassComplex, literal: func() string { return F("complex64(%v)", g.fmtImag(one)) }},
+		&Type{id: "complex128", class: ClassComplex, literal: func() string { return g.fmtImag(one) }},
+
+		&Type{id: "uint", class: ClassNumeric, literal: conv("uint", one)},
+		&Type{id: "uintptr", class: ClassNumeric, literal: conv("uintptr", zero)},
+		&Type{id: "int16", class: ClassNumeric, literal: conv("int16", one)},
+		&Type{id: "error", class: ClassInterface, literal: func() string { return "error(nil)" }},
+
+		&Type{id: "int8", class: ClassNumeric, literal: conv("int8", one)},
+		&Type{id: "int32", class: ClassNumeric, literal: conv("int32", one)},
+		&Type{id: "int64", class: ClassNumeric, literal: conv("int64", one)},
+		&Type{id: "uint8", class: ClassNumeric, literal: conv("uint8", one)},
+		&Type{id: "uint16", class: ClassNumeric, literal: conv("uint16", one)},
+		&Type{id: "uint32", class: ClassNumeric, literal: conv("uint32", one)},
+		&Type{id: "uint64", class: ClassNumeric, literal: conv("uint64", one)},
+	}
+	for _, t := range g.predefinedTypes {
+		t.utyp = t
+	}
+
+	g.stringType = g.predefinedTypes[0]
+	g.boolType = g.predefinedTypes[1]
+	g.intType = g.predefinedTypes[2]
+	g.byteType = g.predefinedTypes[3]
+	g.efaceType = g.predefinedTypes[4]
+	g.runeType = g.predefinedTypes[5]
+	g.float32Type = g.predefinedTypes[6]
+	g.float64Type = g.predefinedTypes[7]
+	g.complex64Type = g.predefinedTypes[8]
+	g.complex128Type = g.predefinedTypes[9]
+	g.errorType = g.predefinedTypes[13]
+	for _, t := range g.predefinedTypes {
+		if t.class == ClassNumeric && !g.isFloat(t) {
+			t, small := t, t.literal
+			t.literal = func() string { return g.intLiteral(t, small) }
+		}
+	}
+
+	g.errorType.elems = []*Var{&Var{id: "Error", typ: g.funcOf(nil, []*Type{g.stringType})}}
+
+	g.anyConstraint = &Type{id: "any", class: ClassInterface}
+	g.comparableConstraint = &Type{id: "comparable", class: ClassInterface}
+
+	g.stringType.complexLiteral = func() string {
+		// Raw strings with a newline are broken across lines.
+		return g.fmtString(g.stringValue() + "\n" + g.stringValue())
+	}
+}
+
+func fmtTypeList(list []*Type, parens bool) string {
+	var buf bytes.Buffer
+	if parens || len(list) > 1 {
+		buf.Write([]byte{'('})
+	}
+	for i, t := range list {
+		if i != 0 {
+			buf.Write([]byte{','})
+		}
+		fmt.Fprintf(&buf, "%v", t.id)
+	}
+	if parens || len(list) > 1 {
+		buf.Write([]byte{')'})
+	}
+	return buf.String()
+}
+
+func (g *Generator) atype(trait TypeClass) *Type {
+	g.typeDepth++
+	defer func() {
+		g.typeDepth--
+	}()
+	for {
+		if g.typeDepth >= g.prof.TypeDepth || g.rndBool() {
+			var cand []*Type
+			for _, t := range g.types() {
+				if g.satisfiesTrait(t, trait) {
+					cand = append(cand, t)
+				}
+			}
+			if len(cand) > 0 {
+				return cand[g.rnd(len(cand))]
+			}
+		}
+		t := g.typeLit(trait)
+		if t != nil && g.satisfiesTrait(t, trait) {
+			return t
+		}
+	}
+}
+
+// predefined returns the predeclared type id.
+func (g *Generator) predefined(id string) *Type {
+	for _, t := range g.predefinedTypes {
+		if t.id == id {
+			return t
+		}
+	}
+	panic("bad")
+}
+
+// aliasRe matches predeclared aliases in type ids.
+var aliasRe = regexp.MustCompile(`\b(byte|rune)\b`)
+
+// unalias returns the predeclared type id with aliases resolved.
+func unalias(id string) string {
+	switch id {
+	case "byte":
+		return "uint8"
+	case "rune":
+		return "int32"
+	default:
+		return id
+	}
+}
+
+// typeLitNames are kinds of type literals, profiles refer to them by name.
+var typeLitNames = []string{"array", "chan", "struct", "pointer", "interface", "slice", "function", "map", "generic"}
+
+// TypeNames returns names of all kinds of type literals.
+func TypeNames() []string {
+	return append([]string(nil), typeLitNames...)
+}
+
+// typeLit returns a new type literal or an instantiation of a generic type.
+// Type literals disabled by the profile are possible if no existing type
+// satisfies trait, otherwise the trait could never be satisfied.
+func (g *Generator) typeLit(trait TypeClass) *Type {
+	weights := g.typeWeights
+	for _, w := range weights {
+		if w == 0 && !g.haveType(trait) {
+			weights = make([]int, len(typeLitNames))
+			for i := range weights {
+				weights[i] = 1
+			}
+			break
+		}
+	}
+	switch typeLitNames[g.weighted(weights)] {
+	case "array":
+		return g.arrayOf(g.atype(TraitAny))
+	case "chan":
+		return g.chanOf(g.atype(TraitAny))
+	case "struct":
+		var elems []*Var
+		for g.rndBool() {
+			elems = append(elems, &Var{id: g.newId("Field"), typ: g.atype(TraitAny)})
+		}
+		return g.structOf(elems)
+	case "pointer":
+		return g.pointerTo(g.atype(TraitAny))
+	case "interface":
+		var elems []*Var
+		var withMethods []*Type
+		for _, t := range g.types() {
+			if len(t.methods) != 0 {
+				withMethods = append(withMethods, t)
+			}
+		}
+		if len(withMethods) != 0 && g.rnd(3) != 0 {
+			// Borrow a subset of methods of an existing type,
+			// so that the interface has implementations.
+			t := withMethods[g.rnd(len(withMethods))]
+			first := g.rnd(len(t.methods))
+			for i, m := range t.methods {
+				if i == first || g.rndBool() {
+					elems = append(elems, &Var{id: m.name, typ: g.funcOf(m.args, m.rets)})
+				}
+			}
+		} else {
+			for g.rndBool() {
+				elems = append(elems, &Var{id: g.newId("Method"), typ: g.funcOf(g.atypeList(TraitAny), g.atypeList(TraitAny))})
+			}
+		}
+		return interfaceOf(elems)
+	case "slice":
+		return g.sliceOf(g.atype(TraitAny))
+	case "function":
+		alist := g.atypeList(TraitAny)
+		if g.rnd(4) == 0 {
+			alist[len(alist)-1] = g.sliceOf(alist[len(alist)-1])
+			return g.variadicFuncOf(alist, g.atypeList(TraitAny))
+		}
+		return g.funcOf(alist, g.atypeList(TraitAny))
+	case "map":
+		return g.mapOf(g.atype(TraitHashable), g.atype(TraitAny))
+	case "generic":
+		gs := g.packages[g.curPackage].generics
+		if len(gs) == 0 {
+			return nil
+		}
+		gt := gs[g.rnd(len(gs))]
+		targs := make([]*Type, len(gt.tparams))
+		for i, tp := range gt.tparams {
+			if targs[i] = g.typeArg(tp.constraint); targs[i] == nil {
+				return nil
+			}
+		}
+		return g.instantiate(gt, targs)
+	default:
+		panic("bad")
+	}
+}
+
+// haveType says whether an existing type satisfies trait.
+func (g *Generator) haveType(trait TypeClass) bool {
+	for _, t := range g.types() {
+		if g.satisfiesTrait(t, trait) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Generator) satisfiesTrait(t *Type, trait TypeClass) bool {
+	if trait < TraitAny {
+		return t.class == trait
+	}
+	if t.class == ClassTypeParam {
+		return g.typeParamTrait(t, trait)
+	}
+
+	switch trait {
+	case TraitAny:
+		return true
+	case TraitOrdered:
+		return t.class == ClassNumeric || t.class == ClassString
+	case TraitComparable:
+		if g.opts.Safe && t.class == ClassInterface {
+			// Comparison of interfaces panics if dynamic types are not comparable.
+			return false
+		}
+		if g.opts.Safe && t.class == ClassPointer && zeroSized(t.ktyp) {
+			return false
+		}
+		return t.class == ClassBoolean || t.class == ClassNumeric || t.class == ClassString ||
+			t.class == ClassPointer || t.class == ClassChan || t.class == ClassInterface
+	case TraitIndexable:
+		return t.class == ClassArray || t.class == ClassSlice || t.class == ClassString ||
+			t.class == ClassMap
+	case TraitReceivable:
+		return t.class == ClassChan
+	case TraitSendable:
+		return t.class == ClassChan
+	case TraitHashable:
+		if g.opts.Safe && (t.class == ClassInterface || t.class == ClassPointer && zeroSized(t.ktyp)) {
+			return false
+		}
+		if t.class == ClassFunction || t.class == ClassMap || t.class == ClassSlice {
+			return false
+		}
+		if t.class == ClassArray && !g.satisfiesTrait(t.ktyp, TraitHashable) {
+			return false
+		}
+		if t.class == ClassStruct {
+			for _, e := range t.elems {
+				if !g.satisfiesTrait(e.typ, TraitHashable) {
+					return false
+				}
+			}
+		}
+		return true
+	case TraitPrintable:
+		return t.class == ClassBoolean || t.class == ClassNumeric || t.class == ClassString ||
+			t.class == ClassPointer || t.class == ClassInterface
+	case TraitLenCapable:
+		return t.class == ClassString || t.class == ClassSlice || t.class == ClassArray ||
+			t.class == ClassMap || t.class == ClassChan
+	case TraitGlobal:
+		for _, t1 := range g.predefinedTypes {
+			if t == t1 {
+				return true
+			}
+		}
+		return false
+	default:
+		panic("bad")
+	}
+}
+
+func (g *Generator) atypeList(trait TypeClass) []*Type {
+	n := g.rnd(4) + 1
+	list := make([]*Type, n)
+	for i := 0; i < n; i++ {
+		list[i] = g.atype(trait)
+	}
+	return list
+}
+
+// sameTypeList says whether the two lists denote identical types.
+// Unnamed types are compared by their spelling.
+func sameTypeList(list0, list1 []*Type) bool {
+	if len(list0) != len(list1) {
+		return false
+	}
+	for i := range list0 {
+		if list0[i].id != list1[i].id {
+			return false
+		}
+	}
+	return true
+}
+
+// implements says whether t implements the interface it.
+func implements(t, it *Type) bool {
+	if it.class != ClassInterface {
+		panic("bad")
+	}
+	for _, e := range it.elems {
+		if !hasMethod(t, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasMethod says whether the method set of t contains method m.
+func hasMethod(t *Type, m *Var) bool {
+	if t.class == ClassInterface || t.class == ClassTypeParam {
+		elems := t.elems
+		if t.class == ClassTypeParam {
+			elems = t.constraint.elems
+		}
+		for _, e := range elems {
+			if e.id == m.id && e.typ.id == m.typ.id {
+				return true
+			}
+		}
+		return false
+	}
+	base := t
+	ptr := false
+	if t.class == ClassPointer && !t.namedUserType {
+		base = t.ktyp
+		ptr = true
+	}
+	for _, f := range base.methods {
+		if f.name == m.id && (ptr || !f.ptrRecv) &&
+			sameTypeList(f.args, m.typ.styp) && sameTypeList(f.rets, m.typ.rtyp) {
+			return true
+		}
+	}
+	return false
+}
+
+// implementation returns a random visible type that implements
+// the interface it, or nil if there are no such types.
+func (g *Generator) implementation(it *Type) *Type {
+	if len(it.elems) == 0 {
+		return g.atype(TraitAny)
+	}
+	var cand []*Type
+	for _, t := range g.types() {
+		if g.opts.Safe && t.class == ClassInterface {
+			// A nil interface value would panic on a method call.
+			continue
+		}
+		if implements(t, it) {
+			cand = append(cand, t)
+		}
+		if len(t.methods) != 0 {
+			if pt := g.pointerTo(t); implements(pt, it) {
+				cand = append(cand, pt)
+			}
+		}
+	}
+	if len(cand) == 0 {
+		return nil
+	}
+	return cand[g.rnd(len(cand))]
+}
+
+// ifaceOf returns a random visible interface type that t implements.
+func (g *Generator) ifaceOf(t *Type) *Type {
+	cand := []*Type{g.efaceType}
+	for _, it := range g.types() {
+		if it.class == ClassInterface && t.class != ClassInterface && implements(t, it) {
+			cand = append(cand, it)
+		}
+	}
+	return cand[g.rnd(len(cand))]
+}
+
+func typeList(t *Type, n int) []*Type {
+	list := make([]*Type, n)
+	for i := 0; i < n; i++ {
+		list[i] = t
+	}
+	return list
+}
+
+func (g *Generator) pointerTo(elem *Type) *Type {
+	return &Type{
+		id:    F("*%v", elem.id),
+		class: ClassPointer,
+		ktyp:  elem,
+		literal: func() string {
+			if g.opts.Safe {
+				return F("new(%v)", elem.id)
+			}
+			return F("(*%v)(nil)", elem.id)
+		}}
+}
+
+func (g *Generator) chanOf(elem *Type) *Type {
+	return &Type{
+		id:    F("chan %v", elem.id),
+		class: ClassChan,
+		ktyp:  elem,
+		literal: func() string {
+			cap := ""
+			if g.rndBool() {
+				cap = "," + g.safeSize()
+			}
+			return F("make(chan %v %v)", elem.id, cap)
+		},
+	}
+}
+
+func (g *Generator) sliceOf(elem *Type) *Type {
+	return &Type{
+		id:    F("[]%v", elem.id),
+		class: ClassSlice,
+		ktyp:  elem,
+		literal: func() string {
+			return F("[]%v{}", elem.id)
+		},
+		complexLiteral: func() string {
+			switch g.choice("normal", "keyed") {
+			case "normal":
+				return F("[]%v{%v}", elem.id, g.fmtRvalueList(typeList(elem, g.rnd(3))))
+			case "keyed":
+				n := g.rnd(3)
+				var indexes []int
+			loop:
+				for len(indexes) < n {
+					i := g.rnd(10)
+					for _, i1 := range indexes {
+						if i1 == i {
+							continue loop
+						}
+					}
+					indexes = append(indexes, i)
+				}
+				var buf bytes.Buffer
+				fmt.Fprintf(&buf, "[]%v{", elem.id)
+				for i, idx := range indexes {
+					if i != 0 {
+						fmt.Fprintf(&buf, ",")
+					}
+					fmt.Fprintf(&buf, "%v: %v", idx, g.rvalue(elem))
+				}
+				fmt.Fprintf(&buf, "}")
+				return buf.String()
+			default:
+				panic("bad")
+			}
+		},
+	}
+}
+
+func (g *Generator) structOf(elems []*Var) *Type {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "struct { ")
+	for _, e := range elems {
+		fmt.Fprintf(&buf, "%v %v\n", e.id, e.typ.id)
+	}
+	fmt.Fprintf(&buf, "}")
+	id := buf.String()
+	return &Type{
+		id:    id,
+		class: ClassStruct,
+		elems: elems,
+		literal: func() string {
+			return F("(%v{})", id)
+		},
+		complexLiteral: func() string {
+			if g.rndBool() {
+				// unnamed
+				var buf bytes.Buffer
+				fmt.Fprintf(&buf, "(%v{", id)
+				for i := 0; i < len(elems); i++ {
+					fmt.Fprintf(&buf, "%v, ", g.rvalue(elems[i].typ))
+				}
+				fmt.Fprintf(&buf, "})")
+				return buf.String()
+			} else {
+				// named
+				var buf bytes.Buffer
+				fmt.Fprintf(&buf, "(%v{", id)
+				for i := 0; i < len(elems); i++ {
+					if g.rndBool() {
+						fmt.Fprintf(&buf, "%v: %v, ", elems[i].id, g.rvalue(elems[i].typ))
+					}
+				}
+				fmt.Fprintf(&buf, "})")
+				return buf.String()
+			}
+		},
+	}
+}
+
+func interfaceOf(elems []*Var) *Type {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "interface { ")
+	for _, e := range elems {
+		fmt.Fprintf(&buf, " %v %v %v\n", e.id, fmtTypeList(e.typ.styp, true), fmtTypeList(e.typ.rtyp, false))
+	}
+	fmt.Fprintf(&buf, "}")
+	return &Type{
+		id:    buf.String(),
+		class: ClassInterface,
+		elems: elems,
+		literal: func() string {
+			return F("%v(nil)", buf.String())
+		},
+	}
+}
+
+func (g *Generator) mapOf(ktyp, vtyp *Type) *Type {
+	return &Type{
+		id:    F("map[%v]%v", ktyp.id, vtyp.id),
+		class: ClassMap,
+		ktyp:  ktyp,
+		vtyp:  vtyp,
+		literal: func() string {
+			if g.rndBool() {
+				cap := ""
+				if g.rndBool() {
+					cap = "," + g.safeSize()
+				}
+				return F("make(map[%v]%v %v)", ktyp.id, vtyp.id, cap)
+			} else {
+				return F("map[%v]%v{}", ktyp.id, vtyp.id)
+			}
+		},
+	}
+}
+
+// namedType returns a new named type id with the underlying type of t.
+func namedType(id string, t *Type) *Type {
+	newTyp := new(Type)
+	*newTyp = *t
+	newTyp.id = id
+	newTyp.namedUserType = true
+	newTyp.methods = nil
+	newTyp.tparams = nil
+	newTyp.targs = nil
+	newTyp.generic = nil
+	newTyp.instances = nil
+	newTyp.utyp = t
+	if t.utyp != nil {
+		newTyp.utyp = t.utyp
+	}
+	if t.class == ClassStruct {
+		newTyp.literal = func() string {
+			// replace struct name with new type id
+			l := t.literal()
+			l = l[len(t.id)+1:]
+			return "(" + id + l
+		}
+		newTyp.complexLiteral = func() string {
+			// replace struct name with new type id
+			l := t.complexLiteral()
+			l = l[len(t.id)+1:]
+			return "(" + id + l
+		}
+	} else {
+		newTyp.literal = func() string {
+			return F("%v(%v)", id, t.literal())
+		}
+		if t.complexLiteral != nil {
+			newTyp.complexLiteral = func() string {
+				return F("%v(%v)", id, t.complexLiteral())
+			}
+		}
+	}
+	return newTyp
+}
+
+func (g *Generator) arrayOf(elem *Type) *Type {
+	size := g.rnd(3)
+	return &Type{
+		id:    F("[%v]%v", size, elem.id),
+		class: ClassArray,
+		ktyp:  elem,
+		size:  size,
+		literal: func() string {
+			return F("[%v]%v{}", size, elem.id)
+		},
+		complexLiteral: func() string {
+			switch g.choice("normal", "keyed") {
+			case "normal":
+				return F("[%v]%v{%v}", g.choice(F("%v", size), "..."), elem.id, g.fmtRvalueList(typeList(elem, size)))
+			case "keyed":
+				var buf bytes.Buffer
+				fmt.Fprintf(&buf, "[%v]%v{", size, elem.id)
+				for i := 0; i < size; i++ {
+					if i != 0 {
+						fmt.Fprintf(&buf, ",")
+					}
+					fmt.Fprintf(&buf, "%v: %v", i, g.rvalue(elem))
+				}
+				fmt.Fprintf(&buf, "}")
+				return buf.String()
+			default:
+				panic("bad")
+			}
+		},
+	}
+}
+
+func (g *Generator) funcOf(alist, rlist []*Type) *Type {
+	return g.newFuncType(alist, rlist, false)
+}
+
+// variadicFuncOf returns type of a function with final parameter ...T,
+// the last element of alist must be []T.
+func (g *Generator) variadicFuncOf(alist, rlist []*Type) *Type {
+	return g.newFuncType(alist, rlist, true)
+}
+
+func (g *Generator) newFuncType(alist, rlist []*Type, variadic bool) *Type {
+	t := &Type{
+		id:       F("func%v %v", fmtParamList(alist, variadic), fmtTypeList(rlist, false)),
+		class:    ClassFunction,
+		styp:     alist,
+		rtyp:     rlist,
+		variadic: variadic,
+	}
+	t.literal = func() string {
+		return F("((func%v %v)(nil))", fmtParamList(alist, variadic), fmtTypeList(rlist, false))
+	}
+	t.complexLiteral = func() string {
+		return g.genFuncLit(t)
+	}
+	return t
+}
+
+// fmtParamList formats parameter types of a function type.
+func fmtParamList(list []*Type, variadic bool) string {
+	if !variadic {
+		return fmtTypeList(list, true)
+	}
+	last := list[len(list)-1]
+	s := fmtTypeList(list[:len(list)-1], true)
+	if len(list) == 1 {
+		return F("(...%v)", last.ktyp.id)
+	}
+	return F("%v, ...%v)", s[:len(s)-1], last.ktyp.id)
+}
+
+func (g *Generator) genFuncLit(ft *Type) string {
+	//return F("((func%v %v)(nil))", fmtTypeList(ft.styp, true), fmtTypeList(ft.rtyp, false))
+	g.features().Closures++
+
+	if g.curBlockPos == -1 {
+		g.line("")
+	}
+
+	f := &Func{args: ft.styp, rets: ft.rtyp, variadic: ft.variadic}
+	curFunc0 := g.curFunc
+	g.curFunc = f
+	curBlock0 := g.curBlock
+	curBlockPos0 := g.curBlockPos
+	curBlockLen0 := len(g.curBlock.sub)
+	exprDepth0 := g.exprDepth
+	exprCount0 := g.exprCount
+	g.exprDepth = 0
+	g.exprCount = 0
+	defer func() {
+		g.curBlock = curBlock0
+		g.curFunc = curFunc0
+		g.exprDepth = exprDepth0
+		g.exprCount = exprCount0
+		g.curBlockPos = curBlockPos0 + (len(g.curBlock.sub) - curBlockLen0)
+	}()
+
+	fb := &Block{parent: g.curBlock, subBlock: g.curBlock.sub[g.curBlockPos]}
+	g.curBlock = fb
+	g.enterBlock(true)
+	g.enterBlock(true)
+	argIds := make([]string, len(f.args))
+	argStr := ""
+	for i := range f.args {
+		argIds[i] = g.newId("Param")
+		if i != 0 {
+			argStr += ", "
+		}
+		argStr += argIds[i] + " " + fmtParam(f, i)
+	}
+	g.line("func(%v)%v {", argStr, fmtTypeList(f.rets, false))
+	for i, a := range f.args {
+		g.defineVar(argIds[i], a)
+	}
+	g.curBlock.funcBoundary = true
+	g.genBlock()
+	g.leaveBlock()
+	g.stmtReturn()
+	g.line("}")
+	g.leaveBlock()
+
+	//b := curBlock.sub[curBlockPos]
+	//copy(curBlock.sub[curBlockPos:], curBlock.sub[curBlockPos+1:])
+	//curBlock.sub = curBlock.sub[:len(curBlock.sub)-1]
+
+	var buf bytes.Buffer
+	serializeBlock(&buf, fb, 0)
+	s := buf.String()
+	//fmt.Printf("GEN FUNC:\n%v\n", s)
+	return s[:len(s)-1]
+}
+
+func dependsOn(t, t0 *Type) bool {
+	if t == nil {
+		return false
+	}
+	if t0 == nil && t.namedUserType {
+		return true
+	}
+	if t == t0 {
+		return true
+	}
+	if dependsOn(t.ktyp, t0) {
+		return true
+	}
+	if dependsOn(t.vtyp, t0) {
+		return true
+	}
+	if dependsOn(t.ktyp, t0) {
+		return true
+	}
+	for _, t1 := range t.styp {
+		if dependsOn(t1, t0) {
+			return true
+		}
+	}
+	for _, t1 := range t.rtyp {
+		if dependsOn(t1, t0) {
+			return true
+		}
+	}
+	for _, e := range t.elems {
+		if dependsOn(e.typ, t0) {
+			return true
+		}
+	}
+	for _, t1 := range t.targs {
+		if dependsOn(t1, t0) {
+			return true
+		}
+	}
+	return false
+}